@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/seiortech/mahakam"
+	"github.com/seiortech/mahakam/middleware"
+)
+
+const usage = `Usage: mahakam <command> [arguments]
+
+Commands:
+  mock [-addr address] [-framework framework] <spec>   serve mocked responses of an OpenAPI document
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "mock":
+		if err := mock(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func mock(args []string) error {
+	flags := flag.NewFlagSet("mock", flag.ExitOnError)
+	address := flags.String("addr", ":8080", "address to listen on")
+	framework := flags.String("framework", string(mahakam.NETPOLL), "network framework: net/http, net or github.com/cloudwego/netpoll")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("mock requires exactly one OpenAPI document, got %d", flags.NArg())
+	}
+
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+
+	doc, err := loader.LoadFromFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to load OpenAPI document: %w", err)
+	}
+
+	nf := mahakam.NetworkFramework(*framework)
+	if !nf.IsValid() {
+		return fmt.Errorf("unsupported server framework: %s", nf)
+	}
+
+	s := mahakam.NewServer(*address, nil)
+	s.Framework(nf)
+	s.Use(middleware.Logger, middleware.CORSMiddleware)
+
+	if err := s.Mock(doc); err != nil {
+		return err
+	}
+
+	log.Printf("Mocking %q (%s) on %s\n", doc.Info.Title, doc.Info.Version, *address)
+
+	return s.ListenAndServe()
+}
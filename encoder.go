@@ -0,0 +1,319 @@
+package mahakam
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/seiortech/mahakam/extensions"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrorEncoderUnsupported is returned by an Encoder that cannot encode the value, so Respond tries the next acceptable encoder.
+	ErrorEncoderUnsupported = errors.New("encoder does not support the value")
+)
+
+// Encoder encodes response values for a media type.
+type Encoder interface {
+	Encode(w io.Writer, v any) error
+}
+
+// EncoderFunc is an adapter to use ordinary functions as Encoder.
+type EncoderFunc func(w io.Writer, v any) error
+
+func (f EncoderFunc) Encode(w io.Writer, v any) error {
+	return f(w, v)
+}
+
+type encoderEntry struct {
+	contentType string // contentType is the registered media type, including its parameters.
+	mediaType   string
+	encoder     Encoder
+}
+
+var (
+	encoders = []encoderEntry{
+		newEncoderEntry("application/json", EncoderFunc(encodeJSON)),
+		newEncoderEntry("application/xml", EncoderFunc(encodeXML)),
+		newEncoderEntry("text/xml", EncoderFunc(encodeXML)),
+		newEncoderEntry("application/msgpack", EncoderFunc(encodeMsgpack)),
+		newEncoderEntry("application/x-msgpack", EncoderFunc(encodeMsgpack)),
+		newEncoderEntry("application/cbor", EncoderFunc(encodeCBOR)),
+		newEncoderEntry("application/x-protobuf", EncoderFunc(encodeProtobuf)),
+		newEncoderEntry("application/protobuf", EncoderFunc(encodeProtobuf)),
+		newEncoderEntry("text/plain; charset=utf-8", EncoderFunc(encodeText)),
+	}
+	encodersMutex sync.RWMutex
+)
+
+func newEncoderEntry(contentType string, encoder Encoder) encoderEntry {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		panic(fmt.Errorf("invalid media type %q: %w", contentType, err))
+	}
+
+	return encoderEntry{
+		contentType: contentType,
+		mediaType:   mediaType,
+		encoder:     encoder,
+	}
+}
+
+// RegisterEncoder registers the encoder for the media type, e.g. `application/yaml` or `text/csv; charset=utf-8`.
+// Registering an existing media type replaces its encoder. When the client accepts several media types equally,
+// the encoders registered first are preferred, starting with the built-in JSON encoder.
+func RegisterEncoder(contentType string, encoder Encoder) {
+	entry := newEncoderEntry(contentType, encoder)
+
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+
+	for i, e := range encoders {
+		if e.mediaType == entry.mediaType {
+			encoders[i] = entry
+			return
+		}
+	}
+
+	encoders = append(encoders, entry)
+}
+
+// acceptRange is a media range of the `Accept` header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+	index     int
+}
+
+func parseAccept(header string) []acceptRange {
+	ranges := []acceptRange{}
+	for i, part := range strings.Split(header, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q, index: i})
+	}
+
+	return ranges
+}
+
+// acceptQuality returns the quality of the media type, taken from the most specific matching range,
+// and the position of that range in the header. ok is false if no range matches.
+func acceptQuality(ranges []acceptRange, mediaType string) (q float64, index int, ok bool) {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	specificity := -1
+
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case r.mediaType == typ+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		}
+
+		if s > specificity {
+			specificity, q, index, ok = s, r.q, r.index, true
+		}
+	}
+
+	return q, index, ok
+}
+
+// negotiateEncoders returns the encoders acceptable for the request, the most preferred first.
+func negotiateEncoders(r *http.Request) []encoderEntry {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+
+	header := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(header) == "" {
+		return append([]encoderEntry(nil), encoders...)
+	}
+
+	type candidate struct {
+		entry encoderEntry
+		q     float64
+		index int
+	}
+
+	ranges := parseAccept(header)
+	candidates := []candidate{}
+	for _, entry := range encoders {
+		q, index, ok := acceptQuality(ranges, entry.mediaType)
+		if !ok || q <= 0 {
+			continue
+		}
+
+		i := len(candidates)
+		for i > 0 && (candidates[i-1].q < q || (candidates[i-1].q == q && candidates[i-1].index > index)) {
+			i--
+		}
+
+		candidates = append(candidates, candidate{})
+		copy(candidates[i+1:], candidates[i:])
+		candidates[i] = candidate{entry: entry, q: q, index: index}
+	}
+
+	result := make([]encoderEntry, len(candidates))
+	for i, c := range candidates {
+		result[i] = c.entry
+	}
+
+	return result
+}
+
+// Respond encodes v with the encoder that best matches the `Accept` header of the request, weighting the media ranges
+// by their q-value, and writes it with the status code. JSON is used when the request doesn't have an `Accept` header.
+// When an encoder fails, e.g. XML on a map, the next acceptable encoder is tried, and the first error is returned
+// if none succeeds. If no registered encoder is acceptable, it returns an extensions.ValidationError with status 406,
+// so the error can be raised to the server's ErrorHandler.
+func Respond(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	addVary(w.Header(), "Accept")
+
+	var buf bytes.Buffer
+	var encodeErr error
+	for _, entry := range negotiateEncoders(r) {
+		buf.Reset()
+
+		err := entry.encoder.Encode(&buf, v)
+		if errors.Is(err, ErrorEncoderUnsupported) {
+			continue
+		}
+
+		if err != nil {
+			if encodeErr == nil {
+				encodeErr = err
+			}
+
+			continue
+		}
+
+		w.Header().Set("Content-Type", entry.contentType)
+		w.WriteHeader(status)
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+
+	if encodeErr != nil {
+		return encodeErr
+	}
+
+	return extensions.ValidationError{
+		Message: http.StatusText(http.StatusNotAcceptable),
+		Code:    http.StatusNotAcceptable,
+		Fields: map[string]any{
+			"Accept": fmt.Sprintf("none of %q can be produced", r.Header.Get("Accept")),
+		},
+	}
+}
+
+// addVary adds the header name to the `Vary` header, unless it is already listed.
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), name) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", name)
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func encodeXML(w io.Writer, v any) error {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func encodeMsgpack(w io.Writer, v any) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+
+	return enc.Encode(v)
+}
+
+func encodeCBOR(w io.Writer, v any) error {
+	return cbor.NewEncoder(w).Encode(v)
+}
+
+func encodeProtobuf(w io.Writer, v any) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return ErrorEncoderUnsupported
+	}
+
+	b, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// encodeText writes strings, byte slices, errors, fmt.Stringer and encoding.TextMarshaler values as plain text.
+func encodeText(w io.Writer, v any) error {
+	var s string
+	switch value := v.(type) {
+	case string:
+		s = value
+	case []byte:
+		s = string(value)
+	case encoding.TextMarshaler:
+		b, err := value.MarshalText()
+		if err != nil {
+			return err
+		}
+		s = string(b)
+	case fmt.Stringer:
+		s = value.String()
+	case error:
+		s = value.Error()
+	default:
+		return ErrorEncoderUnsupported
+	}
+
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -0,0 +1,119 @@
+package mahakam
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/seiortech/mahakam/extensions"
+)
+
+type testPet struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func TestRespond(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		value       any
+		wantType    string
+		wantBody    string
+		wantErrCode int
+	}{
+		{"json without accept", "", testPet{"rex"}, "application/json", `{"name":"rex"}`, 0},
+		{"any media type", "*/*", testPet{"rex"}, "application/json", `{"name":"rex"}`, 0},
+		{"xml", "application/xml", testPet{"rex"}, "application/xml", `<testPet><name>rex</name></testPet>`, 0},
+		{"highest q-value", "application/json;q=0.5, application/xml", testPet{"rex"}, "application/xml", `<testPet><name>rex</name></testPet>`, 0},
+		{"first range on equal q-values", "text/xml, application/json", testPet{"rex"}, "text/xml", `<testPet><name>rex</name></testPet>`, 0},
+		{"specific range over a wildcard", "application/*;q=0.2, text/plain;q=0.1, application/xml;q=0", testPet{"rex"}, "application/json", `{"name":"rex"}`, 0},
+		{"text", "text/plain", "hello", "text/plain; charset=utf-8", "hello", 0},
+		{"text falls back to an acceptable encoder", "text/plain, application/json;q=0.1", testPet{"rex"}, "application/json", `{"name":"rex"}`, 0},
+		{"xml failure falls back to json", "application/xml, application/json;q=0.5", map[string]int{"a": 1}, "application/json", `{"a":1}`, 0},
+		{"not acceptable", "image/png", testPet{"rex"}, "", "", http.StatusNotAcceptable},
+		{"excluded media type", "application/json;q=0, text/plain", testPet{"rex"}, "", "", http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			err := Respond(w, r, http.StatusCreated, tt.value)
+			if tt.wantErrCode != 0 {
+				var validationErr extensions.ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Code != tt.wantErrCode {
+					t.Fatalf("Respond error = %v, want code %d", err, tt.wantErrCode)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Respond: %v", err)
+			}
+
+			if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != tt.wantType || w.Body.String() != tt.wantBody {
+				t.Errorf("Respond = %d %q %q, want 201 %q %q", w.Code, w.Header().Get("Content-Type"), w.Body.String(), tt.wantType, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRespondErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+
+	// Every acceptable encoder fails, so the error of the first one is returned and nothing is written.
+	if err := Respond(w, r, http.StatusOK, map[string]int{"a": 1}); err == nil || errors.As(err, new(extensions.ValidationError)) {
+		t.Errorf("Respond error = %v, want the XML error", err)
+	}
+
+	if w.Body.Len() > 0 {
+		t.Errorf("body = %q, want nothing written", w.Body.String())
+	}
+}
+
+func TestRespondVary(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Vary", "accept, Origin")
+
+	for range 2 {
+		if err := Respond(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "ok"); err != nil {
+			t.Fatalf("Respond: %v", err)
+		}
+	}
+
+	if got := w.Header().Values("Vary"); !slices.Equal(got, []string{"accept, Origin"}) {
+		t.Errorf("Vary = %q, want Accept listed once", got)
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("text/csv; charset=utf-8", EncoderFunc(func(w io.Writer, v any) error {
+		if _, ok := v.(testPet); !ok {
+			return ErrorEncoderUnsupported
+		}
+
+		_, err := io.WriteString(w, "name\n"+v.(testPet).Name+"\n")
+		return err
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	if err := Respond(w, r, http.StatusOK, testPet{"rex"}); err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || w.Body.String() != "name\nrex\n" {
+		t.Errorf("Respond = %q %q, want the registered encoder", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
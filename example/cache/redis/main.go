@@ -23,7 +23,12 @@ func main() {
 		DB:       0,
 	})
 
-	cache, err := extensions.NewRedisCache(redisClient)
+	// Values are stored as JSON, so the handlers work like with MapCache.
+	cache, err := extensions.NewRedisCacheWithOption(redisClient, &extensions.RedisCacheOption{
+		TTL:    5 * time.Minute,
+		Prefix: "example:",
+		Codec:  extensions.JSONCodec,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create Redis cache: %v", err)
 	}
@@ -58,14 +63,7 @@ func main() {
 			Name: name,
 		}
 
-		var cacheData []byte
-		if cacheData, err = json.Marshal(data); err != nil {
-			log.Println("Failed to marshal data:", err)
-			http.Error(w, "Failed to marshal data", http.StatusInternalServerError)
-			return
-		}
-
-		if err := cache.Set(name, cacheData); err != nil {
+		if err := cache.Set(name, data); err != nil {
 			log.Println("Failed to set cache:", err)
 			http.Error(w, "Failed to set cache", http.StatusInternalServerError)
 			return
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
@@ -10,44 +11,30 @@ import (
 )
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=64"`
 }
 
-func (r LoginRequest) Validate() error {
-	errorMap := make(map[string]any)
-	if r.Email == "" {
-		errorMap["email"] = "Email is required"
-	}
-
-	if r.Password == "" {
-		errorMap["password"] = "Password is required"
-	}
-
-	if len(errorMap) > 0 {
-		return extensions.ValidationError{
-			Message: "Invalid request body",
-			Code:    http.StatusBadRequest,
-			Fields:  errorMap,
-		}
-	}
-
-	return nil
+type LoginResponse struct {
+	Message string `json:"message"`
+	Email   string `json:"email"`
 }
 
 func main() {
-	mux := http.NewServeMux()
+	s := mahakam.NewServer("localhost:8080", http.NewServeMux())
+	s.Use(middleware.Logger)
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	// Routes registered through the server are listed by Routes, ServeRoutes and OpenAPI.
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Hello, World!"))
 	})
 
-	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+	s.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"message": "Hello, JSON!"}`))
 	})
 
-	mux.HandleFunc("POST /body", extensions.ValidationMiddleware[LoginRequest](func(w http.ResponseWriter, r *http.Request) {
+	s.HandleFunc("POST /body", extensions.ValidationMiddleware[LoginRequest](func(w http.ResponseWriter, r *http.Request) {
 		body, ok := r.Context().Value(extensions.BodyKey).(LoginRequest)
 		if !ok {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -58,8 +45,13 @@ func main() {
 		w.Write([]byte(`{"message": "Received body successfully", "email": "` + body.Email + `"}`))
 	}))
 
-	s := mahakam.NewServer("localhost:8080", mux)
-	s.Use(middleware.Logger)
+	s.HandleFunc("POST /login", mahakam.Handle(func(ctx context.Context, req LoginRequest) (LoginResponse, error) {
+		return LoginResponse{
+			Message: "Logged in successfully",
+			Email:   req.Email,
+		}, nil
+	}))
+
 	if err := s.ListenAndServe(); err != nil {
 		log.Fatalln("Failed to start server:", err)
 	}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/seiortech/mahakam"
+	"github.com/seiortech/mahakam/sse"
+)
+
+type Tick struct {
+	Time string `json:"time"`
+}
+
+func main() {
+	hub := sse.NewHub(nil)
+
+	go func() {
+		for now := range time.Tick(time.Second) {
+			if _, err := hub.Publish("clock", sse.Event{
+				Event: "tick",
+				Data:  Tick{Time: now.Format(time.RFC3339)},
+			}); err != nil {
+				log.Println("Publish error:", err)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		stream, err := sse.Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer stream.Close()
+
+		if err := hub.Subscribe("clock", stream); err != nil {
+			log.Println("Subscribe error:", err)
+			return
+		}
+
+		stream.Wait()
+	})
+
+	server := mahakam.NewServer("localhost:8080", mux)
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalln("Failed to start server:", err)
+	}
+}
@@ -0,0 +1,295 @@
+package extensions
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrorBindTarget = errors.New("bind target must be a non-nil pointer")
+)
+
+var (
+	// MaxBindBodySize is the maximum size in bytes of the request body read by Bind. Zero or negative disables the limit.
+	MaxBindBodySize int64 = 10 << 20 // 10MB
+	// MaxBindMemory is the maximum size in bytes of a multipart body kept in memory, the rest is stored in temporary files.
+	// It should stay below MaxBindBodySize, otherwise no multipart body is large enough to use temporary files.
+	MaxBindMemory int64 = 4 << 20 // 4MB
+)
+
+var (
+	fileHeaderType  = reflect.TypeFor[*multipart.FileHeader]()
+	fileHeadersType = reflect.TypeFor[[]*multipart.FileHeader]()
+)
+
+// bindSource holds the form values and files decoded from a form or multipart body.
+type bindSource struct {
+	form  url.Values
+	files map[string][]*multipart.FileHeader
+}
+
+// Bind decodes the request into v, which must be a non-nil pointer, usually to a struct.
+// The body is decoded according to its `Content-Type`: JSON (the default), XML, `application/x-www-form-urlencoded`
+// and `multipart/form-data`. Form values are read from fields tagged with `form:"name"`, falling back to the JSON name,
+// and uploaded files can be bound to `*multipart.FileHeader` or `[]*multipart.FileHeader` fields.
+// Fields tagged with `path:"name"`, `query:"name"` and `header:"Name"` are then filled from r.PathValue,
+// the query string and the request headers.
+// Other targets, like maps and slices, are only decoded from a JSON or XML body.
+// The temporary files of a multipart body are removed once the request context is done.
+// Failures are returned as ValidationError: 400 for malformed data, 413 if the body exceeds MaxBindBodySize
+// and 415 for unsupported content types. Messages are localized with the locale of the request (see RequestLocale).
+func Bind(r *http.Request, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return ErrorBindTarget
+	}
+
+	locale := RequestLocale(r)
+	isStruct := rv.Elem().Kind() == reflect.Struct
+
+	source := bindSource{}
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		var err error
+		if source, err = bindBody(r, v, isStruct, locale); err != nil {
+			return err
+		}
+	}
+
+	if !isStruct {
+		return nil
+	}
+
+	res := newValidationResult(locale)
+	bindValues(r, rv.Elem(), source, res)
+
+	return res.error(CodeInvalidRequestParameters, http.StatusBadRequest)
+}
+
+// bindBody decodes the request body according to its content type. Form bodies are only read into structs.
+func bindBody(r *http.Request, v any, isStruct bool, locale string) (bindSource, error) {
+	source := bindSource{}
+
+	if MaxBindBodySize > 0 {
+		if r.ContentLength > MaxBindBodySize {
+			return source, bodyTooLargeError(locale)
+		}
+
+		r.Body = http.MaxBytesReader(nil, r.Body, MaxBindBodySize)
+	}
+
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return source, unsupportedMediaTypeError(contentType, locale)
+		}
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return source, bodyError(err, locale)
+		}
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if err := xml.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return source, bodyError(err, locale)
+		}
+	case !isStruct:
+		return source, unsupportedMediaTypeError(mediaType, locale)
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return source, bodyError(err, locale)
+		}
+
+		source.form = r.PostForm
+	case mediaType == "multipart/form-data":
+		err := r.ParseMultipartForm(MaxBindMemory)
+		if r.MultipartForm != nil {
+			form := r.MultipartForm
+			context.AfterFunc(r.Context(), func() { form.RemoveAll() })
+		}
+
+		if err != nil {
+			return source, bodyError(err, locale)
+		}
+
+		source.form = r.MultipartForm.Value
+		source.files = r.MultipartForm.File
+	default:
+		return source, unsupportedMediaTypeError(mediaType, locale)
+	}
+
+	return source, nil
+}
+
+func bodyTooLargeError(locale string) ValidationError {
+	return ValidationError{
+		Message: translate(locale, CodeRequestBodyTooLarge, "", "", ""),
+		Code:    http.StatusRequestEntityTooLarge,
+	}
+}
+
+func unsupportedMediaTypeError(mediaType, locale string) error {
+	res := newValidationResult(locale)
+	res.add("Content-Type", CodeUnsupportedMediaType, "", strconv.Quote(mediaType))
+
+	return res.error(CodeUnsupportedContentType, http.StatusUnsupportedMediaType)
+}
+
+// bodyError converts a body decoding error into a ValidationError, keyed by the field when the decoder reports it.
+func bodyError(err error, locale string) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return bodyTooLargeError(locale)
+	}
+
+	res := newValidationResult(locale)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		res.add(typeErr.Field, CodeInvalidType, "", typeErr.Type.String())
+	} else {
+		res.add("body", CodeInvalidBody, "", err.Error())
+	}
+
+	return res.error(CodeInvalidRequestBody, http.StatusBadRequest)
+}
+
+// bindValues fills the tagged fields of the struct value from the request, collecting conversion errors into res.
+func bindValues(r *http.Request, rv reflect.Value, source bindSource, res *validationResult) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		value := rv.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			bindValues(r, value, source, res)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		var (
+			name   string
+			values []string
+		)
+
+		if name = field.Tag.Get("path"); name != "" {
+			if v := r.PathValue(name); v != "" {
+				values = []string{v}
+			}
+		} else if name = field.Tag.Get("query"); name != "" {
+			values = r.URL.Query()[name]
+		} else if name = field.Tag.Get("header"); name != "" {
+			values = r.Header.Values(name)
+		} else if source.form != nil || source.files != nil {
+			if name = field.Tag.Get("form"); name == "" {
+				name = jsonFieldName(field)
+			}
+
+			if name == "-" {
+				continue
+			}
+
+			switch field.Type {
+			case fileHeaderType:
+				if files := source.files[name]; len(files) > 0 {
+					value.Set(reflect.ValueOf(files[0]))
+				}
+				continue
+			case fileHeadersType:
+				if files := source.files[name]; len(files) > 0 {
+					value.Set(reflect.ValueOf(files))
+				}
+				continue
+			}
+
+			values = source.form[name]
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setValue(value, values); err != nil {
+			res.add(name, CodeInvalidValue, "", strconv.Quote(values[0]))
+		}
+	}
+}
+
+// setValue converts the string values into the field value. Slices receive every value, other kinds the first one.
+func setValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return setValue(v.Elem(), values)
+	}
+
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(values[0]))
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+
+		v.Set(slice)
+		return nil
+	}
+
+	value := values[0]
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		v.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
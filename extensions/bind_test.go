@@ -0,0 +1,221 @@
+package extensions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBindRequest struct {
+	ID      int       `path:"id"`
+	Page    int       `query:"page"`
+	Sort    []string  `query:"sort"`
+	Token   string    `header:"X-Token"`
+	Since   time.Time `query:"since"`
+	Name    string    `json:"name" xml:"name" form:"full_name"`
+	Age     *int      `json:"age" xml:"age"`
+	Ignored string    `json:"-"`
+}
+
+func newBindRequest(method, target, contentType, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	return r
+}
+
+func TestBind(t *testing.T) {
+	age := 30
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        testBindRequest
+	}{
+		{"json", "application/json", `{"name":"gopher","age":30}`, testBindRequest{Name: "gopher", Age: &age}},
+		{"json by default", "", `{"name":"gopher"}`, testBindRequest{Name: "gopher"}},
+		{"json suffix", "application/problem+json", `{"name":"gopher"}`, testBindRequest{Name: "gopher"}},
+		{"xml", "application/xml", `<testBindRequest><name>gopher</name><age>30</age></testBindRequest>`, testBindRequest{Name: "gopher", Age: &age}},
+		{"form", "application/x-www-form-urlencoded", `full_name=gopher&age=30`, testBindRequest{Name: "gopher", Age: &age}},
+		{"form ignores excluded fields", "application/x-www-form-urlencoded", `Ignored=x&-=x`, testBindRequest{}},
+		{"empty body", "application/json", ``, testBindRequest{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newBindRequest(http.MethodPost, "/users/7?page=2&sort=name&sort=-age&since="+since.Format(time.RFC3339), tt.contentType, tt.body)
+			r.SetPathValue("id", "7")
+			r.Header.Set("X-Token", "secret")
+
+			var got testBindRequest
+			if err := Bind(r, &got); err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+
+			tt.want.ID, tt.want.Page, tt.want.Sort, tt.want.Token, tt.want.Since = 7, 2, []string{"name", "-age"}, "secret", since
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bind = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	defer func(size int64) { MaxBindBodySize = size }(MaxBindBodySize)
+	MaxBindBodySize = 64
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		wantCode    int
+		wantField   string
+	}{
+		{"malformed json", "/", "application/json", `{"name":`, http.StatusBadRequest, "body"},
+		{"wrong json type", "/", "application/json", `{"name":1}`, http.StatusBadRequest, "name"},
+		{"invalid query value", "/?page=two", "application/json", `{}`, http.StatusBadRequest, "page"},
+		{"unsupported content type", "/", "text/plain", `name`, http.StatusUnsupportedMediaType, "Content-Type"},
+		{"invalid content type", "/", "application/", `{}`, http.StatusUnsupportedMediaType, "Content-Type"},
+		{"body too large", "/", "application/json", `{"name":"` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testBindRequest
+			err := Bind(newBindRequest(http.MethodPost, tt.target, tt.contentType, tt.body), &got)
+
+			var validationErr ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Code != tt.wantCode {
+				t.Fatalf("Bind error = %#v, want a ValidationError with code %d", err, tt.wantCode)
+			}
+
+			if _, ok := validationErr.Fields[tt.wantField]; tt.wantField != "" && !ok {
+				t.Errorf("fields = %v, want %q", validationErr.Fields, tt.wantField)
+			}
+		})
+	}
+
+	// The limit also applies to bodies without Content-Length.
+	r := newBindRequest(http.MethodPost, "/", "application/json", `{"name":"`+strings.Repeat("x", 64)+`"}`)
+	r.ContentLength = -1
+	var got testBindRequest
+	if err := Bind(r, &got); !errors.As(err, new(ValidationError)) || err.(ValidationError).Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Bind of a chunked body error = %v, want 413", err)
+	}
+}
+
+func TestBindTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      any
+		contentType string
+		body        string
+		want        any
+		wantCode    int
+	}{
+		{"map", &map[string]int{}, "application/json", `{"a":1}`, &map[string]int{"a": 1}, 0},
+		{"slice", &[]string{}, "application/json", `["a","b"]`, &[]string{"a", "b"}, 0},
+		{"form into a map", &map[string]int{}, "application/x-www-form-urlencoded", `a=1`, nil, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Bind(newBindRequest(http.MethodPost, "/", tt.contentType, tt.body), tt.target)
+			if tt.wantCode != 0 {
+				var validationErr ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Code != tt.wantCode {
+					t.Fatalf("Bind error = %v, want code %d", err, tt.wantCode)
+				}
+				return
+			}
+
+			if err != nil || !reflect.DeepEqual(tt.target, tt.want) {
+				t.Errorf("Bind = %v, %v, want %v", tt.target, err, tt.want)
+			}
+		})
+	}
+
+	for _, target := range []any{nil, testBindRequest{}, (*testBindRequest)(nil)} {
+		if err := Bind(newBindRequest(http.MethodPost, "/", "", `{}`), target); err != ErrorBindTarget {
+			t.Errorf("Bind(%#v) error = %v, want %v", target, err, ErrorBindTarget)
+		}
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	defer func(memory int64) { MaxBindMemory = memory }(MaxBindMemory)
+	MaxBindMemory = 1 // Store the files on disk.
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("full_name", "gopher")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		part, _ := mw.CreateFormFile("files", name)
+		part.Write([]byte("content of " + name))
+	}
+	part, _ := mw.CreateFormFile("avatar", "avatar.png")
+	part.Write([]byte("png"))
+	mw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newBindRequest(http.MethodPost, "/", mw.FormDataContentType(), body.String()).WithContext(ctx)
+
+	var got struct {
+		Name   string                  `form:"full_name"`
+		Avatar *multipart.FileHeader   `form:"avatar"`
+		Files  []*multipart.FileHeader `form:"files"`
+	}
+	if err := Bind(r, &got); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	if got.Name != "gopher" || got.Avatar == nil || got.Avatar.Filename != "avatar.png" || len(got.Files) != 2 {
+		t.Fatalf("Bind = %+v", got)
+	}
+
+	file, err := got.Files[1].Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+
+	if string(content) != "content of b.txt" {
+		t.Errorf("file content = %q", content)
+	}
+
+	if entries, _ := os.ReadDir(tmp); len(entries) == 0 {
+		t.Fatal("the files are kept in memory, want temporary files")
+	}
+
+	// The temporary files are removed once the request context is done.
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if entries, _ := os.ReadDir(tmp); len(entries) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("temporary files were not removed after the request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -2,7 +2,12 @@ package extensions
 
 import (
 	"encoding/json"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Cache is an interface that defines methods for caching data.
@@ -26,36 +31,545 @@ type CacheEntry struct {
 	ExpiresAt int64 // Unix timestamp in seconds
 }
 
-// CacheMiddleware is a middleware that provides caching functionality.
-// It used to caching response data for HTTP requests by matching the request path and method.
-// Key pattern that used by this middleware is `"{method}:{path}"`. For example, if the request path is `/api/users/1`, the key will be `GET:/api/users/1`.
+// CacheKeyFunc returns the cache key of a request. Requests with the same key share the cached response,
+// unless the response varies on request headers with `Vary`.
+type CacheKeyFunc func(r *http.Request) string
+
+// DefaultCacheKey returns `"{method}:{path}"`, followed by `?` and the sorted query string if there is one.
+// For example, `/api/users?page=2&limit=10` is keyed as `GET:/api/users?limit=10&page=2`. HEAD requests use the key of GET.
+func DefaultCacheKey(r *http.Request) string {
+	key := cacheMethod(r) + ":" + r.URL.Path
+	if query := r.URL.Query(); len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+
+	return key
+}
+
+// PathCacheKey returns `"{method}:{path}"`, ignoring the query string.
+func PathCacheKey(r *http.Request) string {
+	return cacheMethod(r) + ":" + r.URL.Path
+}
+
+// QueryCacheKey returns a key function like DefaultCacheKey that only keeps the given query parameters,
+// so tracking parameters like `utm_source` don't split the cache.
+func QueryCacheKey(params ...string) CacheKeyFunc {
+	return func(r *http.Request) string {
+		query := r.URL.Query()
+		kept := make(url.Values)
+		for _, param := range params {
+			if values, ok := query[param]; ok {
+				kept[param] = values
+			}
+		}
+
+		key := cacheMethod(r) + ":" + r.URL.Path
+		if len(kept) > 0 {
+			key += "?" + kept.Encode()
+		}
+
+		return key
+	}
+}
+
+func cacheMethod(r *http.Request) string {
+	if r.Method == http.MethodHead {
+		return http.MethodGet
+	}
+
+	return r.Method
+}
+
+// CacheOption defines the configuration options for the cache middleware.
+type CacheOption struct {
+	// KeyFunc returns the cache key of a request. if nil, DefaultCacheKey is used.
+	KeyFunc CacheKeyFunc
+	// Shared makes the cache behave as a shared cache (RFC 9111): responses with `Cache-Control: private`,
+	// `Set-Cookie`, or to requests with `Authorization` (unless allowed with `public` or `s-maxage`) are not stored,
+	// and `s-maxage` takes precedence over `max-age`.
+	Shared bool
+	// DefaultTTL is the freshness lifetime of responses without `max-age`, `s-maxage` or `Expires`.
+	// Zero uses the default TTL of the cache storage, and a negative value only stores responses with explicit freshness.
+	DefaultTTL time.Duration
+	// StaleWhileRevalidate is how long an expired response is served while it is refreshed in the background,
+	// for responses without a `stale-while-revalidate` directive. Zero disables it.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is how long an expired response is served when the handler fails with a 5xx status or a panic,
+	// for responses without a `stale-if-error` directive. Zero disables it.
+	StaleIfError time.Duration
+	// Jitter shortens the freshness lifetime of every stored response by a random fraction, up to Jitter (0 to 1),
+	// so responses stored together don't all expire at once.
+	Jitter float64
+	// LockTimeout is how long an instance holds the lock of a key while running the handler, when the cache is
+	// shared between instances (see Locker), and how long the other instances wait for its response.
+	LockTimeout time.Duration
+}
+
+// DefaultCacheMiddlewareOption provides default values for cache middleware options.
+var DefaultCacheMiddlewareOption = CacheOption{
+	KeyFunc:              DefaultCacheKey,
+	Shared:               true,
+	DefaultTTL:           0,
+	StaleWhileRevalidate: 0,
+	StaleIfError:         0,
+	Jitter:               0,
+	LockTimeout:          5 * time.Second,
+}
+
+// ResponseCache is an HTTP cache following RFC 9111 in front of the handlers, storing responses in a Cache.
+//
+// GET and HEAD responses are stored with their status code and headers, and replayed with an `Age` header while fresh.
+// Freshness comes from the `s-maxage`, `max-age` or `Expires` of the response, or DefaultTTL for the status codes
+// that are cacheable by default, like 200 and 404. Responses with `no-store`, `no-cache`, `Vary: *`, or that were
+// streamed with Flush are not stored. Responses that vary on request headers are stored once per variant.
+// Conditional requests are answered with 304 from the `ETag` and `Last-Modified` of the cached response (see ETag).
+//
+// The request `Cache-Control` is honored: `no-store` bypasses the cache, `no-cache` fetches a fresh response,
+// `max-age` and `min-fresh` limit the age of the cached response, and `only-if-cached` replies 504 on a miss.
+// Successful unsafe requests, like POST or DELETE, invalidate the cached response of their URL, and the responses
+// tagged with the tags of their `Cache-Tag` header (see AddCacheTags and Invalidator).
+//
+// Concurrent misses of a key are coalesced: one request runs the handler while the others wait for its response,
+// across instances too when the cache implements Locker, like RedisCache. Expired responses are served during their
+// `stale-while-revalidate` window while a single background request refreshes them, and during their
+// `stale-if-error` window when the handler fails.
+type ResponseCache struct {
+	*CacheOption
+	cache   Cache
+	flights flightGroup
+}
+
+// cachedResponse is a response stored in the cache, encoded as JSON so it can be stored in any Cache.
+// When the response varies on request headers, the entry under the request key only holds Vary,
+// and the response is stored under the key of its variant.
+type cachedResponse struct {
+	Status    int         `json:"status,omitempty"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"body,omitempty"`
+	Vary      []string    `json:"vary,omitempty"`
+	StoredAt  int64       `json:"stored_at,omitempty"`  // Unix timestamp in nanoseconds.
+	ExpiresAt int64       `json:"expires_at,omitempty"` // Unix timestamp in nanoseconds, zero if fresh while stored.
+	Age       int64       `json:"age,omitempty"`        // Age in seconds of the response when it was stored.
+	// StaleWhileRevalidate and StaleIfError are the windows in seconds after ExpiresAt where the response can be served stale.
+	StaleWhileRevalidate int64 `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         int64 `json:"stale_if_error,omitempty"`
+}
+
+// hopByHopHeaders only apply to a single connection and are never stored.
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Trailer"}
+
+// NewCacheMiddleware creates a new cache middleware storing responses in the cache. if option is nil, it uses the default options.
+func NewCacheMiddleware(cache Cache, option *CacheOption) *ResponseCache {
+	if option == nil {
+		option = &DefaultCacheMiddlewareOption
+	}
+
+	return &ResponseCache{
+		CacheOption: option,
+		cache:       cache,
+	}
+}
+
+// CacheMiddleware is a middleware that caches the responses of the handler in the cache with the default options.
+// See ResponseCache for the caching rules and DefaultCacheKey for the key pattern.
 func CacheMiddleware(cache Cache, next http.HandlerFunc) http.HandlerFunc {
+	return NewCacheMiddleware(cache, nil).Middleware(next)
+}
+
+func (c *ResponseCache) key(r *http.Request) string {
+	if c.KeyFunc == nil {
+		return DefaultCacheKey(r)
+	}
+
+	return c.KeyFunc(r)
+}
+
+// Middleware returns an HTTP middleware function that serves fresh responses from the cache and stores the others.
+func (c *ResponseCache) Middleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		key := r.Method + ":" + r.URL.Path
-
-		if c, ok := cache.Get(key); ok {
-			if resp, ok := c.([]byte); ok {
-				if isJSON := json.Valid(resp); isJSON {
-					w.Header().Set("Content-Type", "application/json")
-				} else {
-					w.Header().Set("Content-Type", "text/plain")
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			wrapped := NewCustomResponseWriter(w)
+			next(wrapped, r)
+
+			if r.Method != http.MethodOptions && r.Method != http.MethodTrace && wrapped.StatusCode >= 200 && wrapped.StatusCode < 400 {
+				get := *r
+				get.Method = http.MethodGet
+				c.cache.Delete(c.key(&get))
+
+				if tags := cacheTags(wrapped.Header().Values(HEADER_CACHE_TAG)); len(tags) > 0 {
+					c.InvalidateTags(tags...)
 				}
+			}
+
+			wrapped.Header().Del(HEADER_CACHE_TAG)
+			wrapped.Flush()
+			return
+		}
+
+		cc := requestCacheControl(r)
+		if cc.has("no-store") || r.Header.Get("Range") != "" {
+			next(w, r)
+			return
+		}
 
-				w.WriteHeader(http.StatusOK)
-				w.Write(resp)
+		key := c.key(r)
+		now := time.Now()
 
+		var stale *cachedResponse
+		if !cc.has("no-cache") {
+			if entry, fresh, ok := c.lookup(key, r, cc, now); ok {
+				if fresh {
+					c.serve(w, r, entry, now)
+					return
+				}
+
+				// The client didn't ask for a fresher response than the stale one, serve it while refreshing it.
+				if entry.staleWithin(entry.StaleWhileRevalidate, now) && !cc.has("max-age") && !cc.has("min-fresh") {
+					c.serve(w, r, entry, now)
+					c.revalidate(key, r, next)
+					return
+				}
+
+				stale = &entry
+			}
+		}
+
+		if cc.has("only-if-cached") {
+			http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+			return
+		}
+
+		if r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		c.fill(w, r, key, cc, stale, next)
+	}
+}
+
+// run runs the handler for a cache miss and stores its response. If the handler fails with a server error or a panic,
+// the stale response is served instead while its `stale-if-error` window is open.
+func (c *ResponseCache) run(w http.ResponseWriter, r *http.Request, key string, stale *cachedResponse, next http.HandlerFunc) {
+	now := time.Now()
+
+	// A conditional request is forwarded without its validators, so the full response can be stored,
+	// then the validators are checked against it.
+	inner, conditional := unconditionalRequest(r)
+
+	wrapped := NewCustomResponseWriter(w)
+
+	if stale != nil && stale.StaleIfError > 0 {
+		header := w.Header().Clone()
+		serveStale := func() bool {
+			if wrapped.flushed || !stale.staleWithin(stale.StaleIfError, time.Now()) {
+				return false
+			}
+
+			clear(w.Header())
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+
+			c.serve(w, r, *stale, time.Now())
+			return true
+		}
+
+		defer func() {
+			if recovered := recover(); recovered != nil && !serveStale() {
+				panic(recovered)
+			}
+		}()
+
+		next(wrapped, inner)
+
+		if wrapped.StatusCode >= http.StatusInternalServerError && serveStale() {
+			return
+		}
+	} else {
+		next(wrapped, inner)
+	}
+
+	if !wrapped.flushed {
+		c.store(key, r, wrapped.StatusCode, wrapped.Header(), wrapped.Body.Bytes(), now)
+		w.Header().Del(HEADER_CACHE_TAG)
+
+		if conditional && wrapped.StatusCode == http.StatusOK {
+			lastModified, _ := http.ParseTime(wrapped.Header().Get("Last-Modified"))
+			if !CheckPreconditions(w, r, wrapped.Header().Get("ETag"), lastModified) {
 				return
 			}
 		}
+	}
+
+	wrapped.Flush()
+}
+
+// unconditionalRequest returns the request without `If-None-Match` and `If-Modified-Since`, and whether it had them.
+func unconditionalRequest(r *http.Request) (*http.Request, bool) {
+	if r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "" {
+		return r, false
+	}
+
+	unconditional := *r
+	unconditional.Header = r.Header.Clone()
+	unconditional.Header.Del("If-None-Match")
+	unconditional.Header.Del("If-Modified-Since")
+
+	return &unconditional, true
+}
+
+// get returns the entry stored under the key.
+func (c *ResponseCache) get(key string) (cachedResponse, bool) {
+	var entry cachedResponse
 
-		wrapped := NewCustomResponseWriter(w)
-		next(wrapped, r)
+	value, ok := c.cache.Get(key)
+	if !ok {
+		return entry, false
+	}
 
-		capturedBody := wrapped.Body.Bytes()
-		if wrapped.StatusCode == http.StatusOK && len(capturedBody) > 0 {
-			cache.Set(key, capturedBody)
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return entry, false
+	}
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// lookup returns the cached response for the request, and whether it satisfies the freshness requirements
+// of the request. Stale responses are returned while stored, for `stale-while-revalidate` and `stale-if-error`.
+func (c *ResponseCache) lookup(key string, r *http.Request, cc cacheControl, now time.Time) (cachedResponse, bool, bool) {
+	entry, ok := c.get(key)
+	if !ok {
+		return entry, false, false
+	}
+
+	if entry.Status == 0 && len(entry.Vary) > 0 {
+		if entry, ok = c.get(variantKey(key, entry.Vary, r)); !ok || entry.Status == 0 {
+			return entry, false, false
+		}
+	}
+
+	if entry.ExpiresAt > 0 {
+		remaining := time.Unix(0, entry.ExpiresAt).Sub(now)
+		if remaining <= 0 {
+			return entry, false, true
+		}
+
+		if minFresh, ok := cc.seconds("min-fresh"); ok && remaining < minFresh {
+			return entry, false, true
+		}
+	}
+
+	if maxAge, ok := cc.seconds("max-age"); ok && entry.age(now) > maxAge {
+		return entry, false, true
+	}
+
+	return entry, true, true
+}
+
+// age returns the current age of the cached response (RFC 9111 section 4.2.3).
+func (e cachedResponse) age(now time.Time) time.Duration {
+	return time.Duration(e.Age)*time.Second + max(now.Sub(time.Unix(0, e.StoredAt)), 0)
+}
+
+// staleWithin reports whether the expired response is still within window seconds after its expiration.
+func (e cachedResponse) staleWithin(window int64, now time.Time) bool {
+	return e.ExpiresAt > 0 && window > 0 && now.Before(time.Unix(0, e.ExpiresAt).Add(time.Duration(window)*time.Second))
+}
+
+// serve replies with the cached response.
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, entry cachedResponse, now time.Time) {
+	header := w.Header()
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+
+	header.Set("Age", strconv.FormatInt(int64(entry.age(now)/time.Second), 10))
+
+	if entry.Status == http.StatusOK {
+		lastModified, _ := http.ParseTime(entry.Header.Get("Last-Modified"))
+		if !CheckPreconditions(w, r, entry.Header.Get("ETag"), lastModified) {
+			return
+		}
+	}
+
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead && len(entry.Body) > 0 {
+		w.Write(entry.Body)
+	}
+}
+
+// store stores the response if it is cacheable.
+func (c *ResponseCache) store(key string, r *http.Request, status int, header http.Header, body []byte, now time.Time) {
+	// Partial and not modified responses answer a particular request, they are not the representation to store.
+	if status < 200 || status == http.StatusPartialContent || status == http.StatusNotModified || status == http.StatusPreconditionFailed {
+		return
+	}
+
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	if cc.has("no-store") || cc.has("no-cache") {
+		return
+	}
+
+	if c.Shared {
+		if cc.has("private") || header.Get("Set-Cookie") != "" {
+			return
+		}
+
+		if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+			return
+		}
+	}
+
+	vary := varyHeaders(header.Values("Vary"))
+	if len(vary) == 1 && vary[0] == "*" {
+		return
+	}
+
+	// An encoded body can only be replayed to clients that accept its encoding.
+	if header.Get("Content-Encoding") != "" && !containsHeader(vary, "Accept-Encoding") {
+		return
+	}
+
+	lifetime, explicit := freshnessLifetime(header, cc, c.Shared, now)
+	if !explicit {
+		if !heuristicallyCacheable[status] || c.DefaultTTL < 0 {
+			return
+		}
+
+		lifetime = c.DefaultTTL
+	}
+
+	if c.Jitter > 0 && lifetime > 0 {
+		lifetime -= time.Duration(rand.Float64() * min(c.Jitter, 1) * float64(lifetime))
+	}
+
+	// Serving stale responses is forbidden by must-revalidate, and by proxy-revalidate for shared caches.
+	var staleWhileRevalidate, staleIfError time.Duration
+	if !cc.has("must-revalidate") && (!c.Shared || !cc.has("proxy-revalidate")) {
+		staleWhileRevalidate, staleIfError = c.StaleWhileRevalidate, c.StaleIfError
+		if d, ok := cc.seconds("stale-while-revalidate"); ok {
+			staleWhileRevalidate = d
+		}
+
+		if d, ok := cc.seconds("stale-if-error"); ok {
+			staleIfError = d
 		}
+	}
+
+	var initialAge int64
+	if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+		initialAge = age
+	}
+
+	entry := cachedResponse{
+		Status:   status,
+		Header:   header.Clone(),
+		Body:     body,
+		StoredAt: now.UnixNano(),
+		Age:      initialAge,
+
+		StaleWhileRevalidate: int64(staleWhileRevalidate / time.Second),
+		StaleIfError:         int64(staleIfError / time.Second),
+	}
+
+	for _, name := range hopByHopHeaders {
+		entry.Header.Del(name)
+	}
 
-		wrapped.Flush()
+	entry.Header.Del("Age")
+	entry.Header.Del(HEADER_CACHE_TAG)
+	if entry.Header.Get("Date") == "" {
+		entry.Header.Set("Date", now.UTC().Format(http.TimeFormat))
 	}
+
+	var expiresAt time.Time
+	if lifetime > 0 || explicit {
+		expiresAt = now.Add(lifetime - time.Duration(initialAge)*time.Second)
+		if !expiresAt.After(now) {
+			return
+		}
+
+		entry.ExpiresAt = expiresAt.UnixNano()
+
+		// Stale responses are kept as long as they can be served.
+		expiresAt = expiresAt.Add(max(staleWhileRevalidate, staleIfError))
+	}
+
+	tags := cacheTags(header.Values(HEADER_CACHE_TAG))
+	invalidator, _ := c.cache.(Invalidator)
+
+	if len(vary) > 0 {
+		if !c.set(key, cachedResponse{Vary: vary}, expiresAt) {
+			return
+		}
+
+		if invalidator != nil && len(tags) > 0 {
+			invalidator.Tag(key, tags...)
+		}
+
+		key = variantKey(key, vary, r)
+	}
+
+	if c.set(key, entry, expiresAt) && invalidator != nil && len(tags) > 0 {
+		invalidator.Tag(key, tags...)
+	}
+}
+
+// set stores the entry until expiresAt if it is set, or for the default TTL of the cache otherwise.
+func (c *ResponseCache) set(key string, entry cachedResponse, expiresAt time.Time) bool {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return false
+	}
+
+	// Entries are stored as strings, which every codec of RedisCache decodes as stored.
+	data := string(encoded)
+
+	if expiresAt.IsZero() {
+		return c.cache.Set(key, data) == nil
+	}
+
+	// The storage expires in whole seconds, rounded up so the entry outlives its freshness.
+	return c.cache.SetWithExpiration(key, data, (expiresAt.UnixNano()+int64(time.Second)-1)/int64(time.Second)) == nil
+}
+
+// variantKey returns the key of the response variant selected by the request headers listed in vary.
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+
+	for _, name := range vary {
+		values := strings.Split(strings.Join(r.Header.Values(name), ","), ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(values, ","))
+	}
+
+	return b.String()
+}
+
+func containsHeader(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,139 @@
+// Package cache defines Cache, a typed and context-aware cache interface, implemented over the caches of the
+// extensions package. Adapt turns a Cache into an extensions.Cache, e.g. for the response cache middleware.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// NoExpiration is the time-to-live of entries that never expire.
+const NoExpiration time.Duration = -1
+
+var (
+	ErrorCacheMiss       = errors.New("cache: key not found")
+	ErrorCacheType       = errors.New("cache: value has an unexpected type")
+	ErrorCacheNotInteger = errors.New("cache: value is not an integer")
+	ErrorCacheOverflow   = errors.New("cache: increment overflows the integer value")
+)
+
+// Cache is a cache of values of type V. Every method takes the context of the caller, so its deadline and
+// cancellation reach the storage. A ttl of zero stores the entry with the default time-to-live of the storage,
+// and NoExpiration stores it forever.
+type Cache[V any] interface {
+	// Get retrieves the value of the key, or ErrorCacheMiss if it is missing or expired.
+	Get(ctx context.Context, key string) (V, error)
+	// GetMulti retrieves the values of the keys. Missing keys are absent from the returned map.
+	GetMulti(ctx context.Context, keys ...string) (map[string]V, error)
+	// Set stores the value of the key.
+	Set(ctx context.Context, key string, value V, ttl time.Duration) error
+	// SetMulti stores the values of the keys, all with the same time-to-live.
+	SetMulti(ctx context.Context, values map[string]V, ttl time.Duration) error
+	// SetNX stores the value only if the key is missing, reporting whether it was stored.
+	SetNX(ctx context.Context, key string, value V, ttl time.Duration) (bool, error)
+	// CompareAndSwap replaces the value of the key with new only if it is equal to old, reporting whether it was
+	// replaced. The entry keeps its time-to-live.
+	CompareAndSwap(ctx context.Context, key string, old, new V) (bool, error)
+	// Increment adds delta to the integer value of the key and returns the result. A missing key starts at zero
+	// and does not expire. It returns ErrorCacheNotInteger if the value is not an integer, and ErrorCacheOverflow
+	// if the result doesn't fit the integer type, e.g. below zero for an unsigned value.
+	Increment(ctx context.Context, key string, delta int64) (int64, error)
+	// TTL returns the remaining time-to-live of the key, NoExpiration if it never expires,
+	// or ErrorCacheMiss if it is missing.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Delete removes the keys. Missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+	// Exists checks if the key exists.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Close closes the cache storage, releasing any resources it holds.
+	Close() error
+}
+
+// adapter is the extensions.Cache of a Cache, see Adapt.
+type adapter[V any] struct {
+	cache Cache[V]
+}
+
+// Adapt returns an extensions.Cache backed by the cache, using context.Background for every call.
+// Storing a value that is not a V returns ErrorCacheType, except `string` and `[]byte` values which are converted
+// to each other. For example, a cache of `[]byte` values can back the response cache middleware:
+//
+//	responses := extensions.NewCacheMiddleware(cache.Adapt(cache.NewRedis[[]byte](redisCache)), nil)
+func Adapt[V any](cache Cache[V]) extensions.Cache {
+	return &adapter[V]{cache: cache}
+}
+
+func (a *adapter[V]) Get(key string) (interface{}, bool) {
+	value, err := a.cache.Get(context.Background(), key)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// value returns the value as a V, converting between `string` and `[]byte`.
+func (a *adapter[V]) value(value interface{}) (V, error) {
+	if v, ok := value.(V); ok {
+		return v, nil
+	}
+
+	var v V
+	switch target := any(&v).(type) {
+	case *[]byte:
+		if s, ok := value.(string); ok {
+			*target = []byte(s)
+			return v, nil
+		}
+	case *string:
+		if b, ok := value.([]byte); ok {
+			*target = string(b)
+			return v, nil
+		}
+	}
+
+	return v, ErrorCacheType
+}
+
+func (a *adapter[V]) Set(key string, value interface{}) error {
+	v, err := a.value(value)
+	if err != nil {
+		return err
+	}
+
+	return a.cache.Set(context.Background(), key, v, 0)
+}
+
+func (a *adapter[V]) SetWithExpiration(key string, value interface{}, expiration int64) error {
+	v, err := a.value(value)
+	if err != nil {
+		return err
+	}
+
+	ttl := NoExpiration
+	if expiration > 0 {
+		ttl = time.Until(time.Unix(expiration, 0))
+		if ttl <= 0 {
+			return a.cache.Delete(context.Background(), key)
+		}
+	}
+
+	return a.cache.Set(context.Background(), key, v, ttl)
+}
+
+func (a *adapter[V]) Delete(key string) error {
+	return a.cache.Delete(context.Background(), key)
+}
+
+func (a *adapter[V]) Exists(key string) bool {
+	ok, err := a.cache.Exists(context.Background(), key)
+
+	return err == nil && ok
+}
+
+func (a *adapter[V]) Close() error {
+	return a.cache.Close()
+}
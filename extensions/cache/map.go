@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// Map is a Cache of values of type V stored in an extensions.MapCache. Values are stored as is, and values of
+// another type, e.g. stored through the extensions.Cache interface of the MapCache, return ErrorCacheType.
+type Map[V any] struct {
+	cache *extensions.MapCache
+}
+
+// NewMap creates a Map over the MapCache. if cache is nil, it uses a new MapCache with the default options.
+func NewMap[V any](cache *extensions.MapCache) *Map[V] {
+	if cache == nil {
+		cache = extensions.NewMapCache()
+	}
+
+	return &Map[V]{cache: cache}
+}
+
+// MapCache returns the underlying MapCache.
+func (m *Map[V]) MapCache() *extensions.MapCache {
+	return m.cache
+}
+
+// expiresAt returns the expiration time of an entry stored now with the ttl.
+func (m *Map[V]) expiresAt(ttl time.Duration) int64 {
+	switch {
+	case ttl == 0:
+		ttl = m.cache.DefaultTTL()
+	case ttl < 0:
+		return 0
+	}
+
+	// MapCache expires entries at the second, rounded up so they don't expire before the ttl.
+	expiresAt := time.Now().Add(ttl)
+	if expiresAt.Nanosecond() > 0 {
+		return expiresAt.Unix() + 1
+	}
+
+	return expiresAt.Unix()
+}
+
+// value returns the value of the entry as a V.
+func (m *Map[V]) value(entry extensions.CacheEntry) (V, error) {
+	v, ok := entry.Value.(V)
+	if !ok {
+		var zero V
+		return zero, ErrorCacheType
+	}
+
+	return v, nil
+}
+
+// Get retrieves the value of the key.
+func (m *Map[V]) Get(ctx context.Context, key string) (V, error) {
+	var zero V
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	entry, ok := m.cache.GetEntry(key)
+	if !ok {
+		return zero, ErrorCacheMiss
+	}
+
+	return m.value(entry)
+}
+
+// GetMulti retrieves the values of the keys. Missing keys are absent from the returned map.
+func (m *Map[V]) GetMulti(ctx context.Context, keys ...string) (map[string]V, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]V, len(keys))
+	for _, key := range keys {
+		entry, ok := m.cache.GetEntry(key)
+		if !ok {
+			continue
+		}
+
+		v, err := m.value(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		values[key] = v
+	}
+
+	return values, nil
+}
+
+// Set stores the value of the key.
+func (m *Map[V]) Set(ctx context.Context, key string, value V, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return m.cache.SetWithExpiration(key, value, m.expiresAt(ttl))
+}
+
+// SetMulti stores the values of the keys.
+func (m *Map[V]) SetMulti(ctx context.Context, values map[string]V, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	expiresAt := m.expiresAt(ttl)
+	for key, value := range values {
+		if err := m.cache.SetWithExpiration(key, value, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetNX stores the value only if the key is missing.
+func (m *Map[V]) SetNX(ctx context.Context, key string, value V, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	stored := false
+	err := m.cache.Update(key, func(entry extensions.CacheEntry, ok bool) (extensions.CacheEntry, bool) {
+		if ok {
+			return entry, false
+		}
+
+		stored = true
+		return extensions.CacheEntry{Value: value, ExpiresAt: m.expiresAt(ttl)}, true
+	})
+
+	return stored && err == nil, err
+}
+
+// CompareAndSwap replaces the value of the key with new only if it is deeply equal to old.
+func (m *Map[V]) CompareAndSwap(ctx context.Context, key string, old, new V) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	swapped := false
+	err := m.cache.Update(key, func(entry extensions.CacheEntry, ok bool) (extensions.CacheEntry, bool) {
+		if !ok || !reflect.DeepEqual(entry.Value, old) {
+			return entry, false
+		}
+
+		swapped = true
+		return extensions.CacheEntry{Value: new, ExpiresAt: entry.ExpiresAt}, true
+	})
+
+	return swapped && err == nil, err
+}
+
+// Increment adds delta to the integer value of the key, keeping its type. A missing key starts at the zero V
+// if V is an integer type, and at an int64 zero otherwise.
+func (m *Map[V]) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	var err error
+	updateErr := m.cache.Update(key, func(entry extensions.CacheEntry, ok bool) (extensions.CacheEntry, bool) {
+		if !ok {
+			entry = extensions.CacheEntry{Value: zeroInt[V]()}
+		}
+
+		var value interface{}
+		value, n, err = addInt(entry.Value, delta)
+		if err != nil {
+			return entry, false
+		}
+
+		return extensions.CacheEntry{Value: value, ExpiresAt: entry.ExpiresAt}, true
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, updateErr
+}
+
+// zeroInt returns the zero V if V is an integer type, or nil, an int64 zero for addInt.
+func zeroInt[V any]() interface{} {
+	var zero V
+	switch reflect.ValueOf(&zero).Elem().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return zero
+	}
+
+	return nil
+}
+
+// addInt adds delta to the integer value, returning the sum with the type of value and as an int64.
+// A nil value is an int64 zero. It returns ErrorCacheOverflow if the sum doesn't fit the type of value or an int64,
+// e.g. when an unsigned value would become negative.
+func addInt(value interface{}, delta int64) (interface{}, int64, error) {
+	if value == nil {
+		return delta, delta, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int() + delta
+		if (delta > 0 && n < v.Int()) || (delta < 0 && n > v.Int()) || v.OverflowInt(n) {
+			return nil, 0, ErrorCacheOverflow
+		}
+
+		sum := reflect.New(v.Type()).Elem()
+		sum.SetInt(n)
+		return sum.Interface(), n, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return nil, 0, ErrorCacheOverflow
+		}
+
+		n := int64(v.Uint()) + delta
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return nil, 0, ErrorCacheOverflow
+		}
+
+		sum := reflect.New(v.Type()).Elem()
+		sum.SetUint(uint64(n))
+		return sum.Interface(), n, nil
+	}
+
+	return nil, 0, ErrorCacheNotInteger
+}
+
+// TTL returns the remaining time-to-live of the key.
+func (m *Map[V]) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	entry, ok := m.cache.GetEntry(key)
+	if !ok {
+		return 0, ErrorCacheMiss
+	}
+
+	if entry.ExpiresAt <= 0 {
+		return NoExpiration, nil
+	}
+
+	return max(0, time.Until(time.Unix(entry.ExpiresAt, 0))), nil
+}
+
+// Delete removes the keys.
+func (m *Map[V]) Delete(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := m.cache.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exists checks if the key exists and has not expired.
+func (m *Map[V]) Exists(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	_, ok := m.cache.GetEntry(key)
+
+	return ok, nil
+}
+
+// Close closes the underlying MapCache.
+func (m *Map[V]) Close() error {
+	return m.cache.Close()
+}
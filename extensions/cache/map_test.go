@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/seiortech/mahakam/extensions"
+)
+
+func TestAddInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		delta   int64
+		want    interface{}
+		wantN   int64
+		wantErr error
+	}{
+		{"nil starts at int64 zero", nil, 3, int64(3), 3, nil},
+		{"int keeps its type", 5, -2, 3, 3, nil},
+		{"int8 overflow", int8(120), 10, nil, 0, ErrorCacheOverflow},
+		{"int8 underflow", int8(-120), -10, nil, 0, ErrorCacheOverflow},
+		{"int64 overflow", int64(math.MaxInt64), 1, nil, 0, ErrorCacheOverflow},
+		{"int64 underflow", int64(math.MinInt64), -1, nil, 0, ErrorCacheOverflow},
+		{"uint keeps its type", uint(5), 2, uint(7), 7, nil},
+		{"uint down to zero", uint16(5), -5, uint16(0), 0, nil},
+		{"uint below zero", uint(5), -6, nil, 0, ErrorCacheOverflow},
+		{"uint8 overflow", uint8(250), 10, nil, 0, ErrorCacheOverflow},
+		{"uint64 above int64", uint64(math.MaxUint64), -1, nil, 0, ErrorCacheOverflow},
+		{"string", "5", 1, nil, 0, ErrorCacheNotInteger},
+		{"float", 1.5, 1, nil, 0, ErrorCacheNotInteger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := addInt(tt.value, tt.delta)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("addInt(%#v, %d) error = %v, want %v", tt.value, tt.delta, err, tt.wantErr)
+			}
+
+			if got != tt.want || n != tt.wantN {
+				t.Errorf("addInt(%#v, %d) = %#v, %d, want %#v, %d", tt.value, tt.delta, got, n, tt.want, tt.wantN)
+			}
+		})
+	}
+}
+
+func TestMapIncrementMissingKey(t *testing.T) {
+	ctx := context.Background()
+
+	counters := NewMap[int](extensions.NewMapCache())
+	defer counters.Close()
+
+	if n, err := counters.Increment(ctx, "hits", 2); n != 2 || err != nil {
+		t.Fatalf("Increment = %d, %v, want 2, nil", n, err)
+	}
+
+	if value, err := counters.Get(ctx, "hits"); value != 2 || err != nil {
+		t.Errorf("Get = %d, %v, want the counter as an int", value, err)
+	}
+
+	if ttl, err := counters.TTL(ctx, "hits"); ttl != NoExpiration || err != nil {
+		t.Errorf("TTL = %v, %v, want NoExpiration", ttl, err)
+	}
+
+	names := NewMap[string](extensions.NewMapCache())
+	defer names.Close()
+
+	if n, err := names.Increment(ctx, "hits", 1); n != 1 || err != nil {
+		t.Errorf("Increment of a missing key in a string cache = %d, %v, want 1, nil", n, err)
+	}
+
+	names.Set(ctx, "name", "value", time.Minute)
+	if _, err := names.Increment(ctx, "name", 1); !errors.Is(err, ErrorCacheNotInteger) {
+		t.Errorf("Increment of a string error = %v, want %v", err, ErrorCacheNotInteger)
+	}
+
+	unsigned := NewMap[uint](extensions.NewMapCache())
+	defer unsigned.Close()
+
+	if _, err := unsigned.Increment(ctx, "stock", -1); !errors.Is(err, ErrorCacheOverflow) {
+		t.Errorf("Increment below zero error = %v, want %v", err, ErrorCacheOverflow)
+	}
+
+	if exists, _ := unsigned.Exists(ctx, "stock"); exists {
+		t.Error("a failed Increment stored the key")
+	}
+}
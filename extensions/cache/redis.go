@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// compareAndSwapScript replaces the value of KEYS[1] with ARGV[2] if it is ARGV[1], keeping its time-to-live.
+var compareAndSwapScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+	return 1
+end
+return 0
+`)
+
+// Replies of Redis to INCRBY, without their `ERR` prefix, for a value that is not an integer and for an overflow.
+const (
+	redisNotInteger = "value is not an integer"
+	redisOverflow   = "increment or decrement would overflow"
+)
+
+// Redis is a Cache of values of type V stored in an extensions.RedisCache, under its key prefix. Values are encoded
+// with the codec of the RedisCache, so both views of a key agree, except with RawCodec, where `[]byte` and `string`
+// values are stored as is and other values as JSON.
+//
+// Increment needs the values stored as decimal text: integers encoded as JSON, or strings stored as is with RawCodec.
+// With the other codecs, like MsgpackCodec or GobCodec, it returns ErrorCacheNotInteger.
+type Redis[V any] struct {
+	cache  *extensions.RedisCache
+	client redis.UniversalClient
+	codec  extensions.Codec
+	raw    bool // raw stores the `[]byte` and `string` values as is.
+}
+
+// NewRedis creates a Redis over the RedisCache.
+func NewRedis[V any](cache *extensions.RedisCache) *Redis[V] {
+	codec, raw := redisCodec[V](cache.Codec())
+
+	return &Redis[V]{cache: cache, client: cache.Client(), codec: codec, raw: raw}
+}
+
+// redisCodec returns the codec of the values of type V in a RedisCache with the codec, and whether they are stored as is.
+func redisCodec[V any](codec extensions.Codec) (extensions.Codec, bool) {
+	if codec != extensions.RawCodec {
+		return codec, false
+	}
+
+	switch any(*new(V)).(type) {
+	case []byte, string:
+		return codec, true
+	}
+
+	return extensions.JSONCodec, false
+}
+
+// RedisCache returns the underlying RedisCache.
+func (c *Redis[V]) RedisCache() *extensions.RedisCache {
+	return c.cache
+}
+
+// expiration returns the expiration given to Redis for the ttl, zero meaning no expiration.
+func (c *Redis[V]) expiration(ttl time.Duration) time.Duration {
+	switch {
+	case ttl == 0:
+		return c.cache.DefaultTTL()
+	case ttl < 0:
+		return 0
+	}
+
+	return ttl
+}
+
+func (c *Redis[V]) encode(value V) ([]byte, error) {
+	if c.raw {
+		switch v := any(value).(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	}
+
+	return c.codec.Marshal(value)
+}
+
+func (c *Redis[V]) decode(data []byte) (V, error) {
+	var value V
+	if c.raw {
+		switch v := any(&value).(type) {
+		case *[]byte:
+			*v = data
+			return value, nil
+		case *string:
+			*v = string(data)
+			return value, nil
+		}
+	}
+
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return value, errors.Join(ErrorCacheType, err)
+	}
+
+	return value, nil
+}
+
+// Get retrieves the value of the key.
+func (c *Redis[V]) Get(ctx context.Context, key string) (V, error) {
+	data, err := c.client.Get(ctx, c.cache.Key(key)).Bytes()
+	if err != nil {
+		var zero V
+		if err == redis.Nil {
+			err = ErrorCacheMiss
+		}
+
+		return zero, err
+	}
+
+	return c.decode(data)
+}
+
+// GetMulti retrieves the values of the keys in a single pipeline, which a cluster routes to the node of every key.
+// Missing keys are absent from the returned map.
+func (c *Redis[V]) GetMulti(ctx context.Context, keys ...string) (map[string]V, error) {
+	values := make(map[string]V, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, c.cache.Key(key))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := c.decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		values[keys[i]] = value
+	}
+
+	return values, nil
+}
+
+// Set stores the value of the key.
+func (c *Redis[V]) Set(ctx context.Context, key string, value V, ttl time.Duration) error {
+	data, err := c.encode(value)
+	if err != nil {
+		return err
+	}
+
+	return c.client.Set(ctx, c.cache.Key(key), data, c.expiration(ttl)).Err()
+}
+
+// SetMulti stores the values of the keys in a single pipeline.
+func (c *Redis[V]) SetMulti(ctx context.Context, values map[string]V, ttl time.Duration) error {
+	pipe := c.client.Pipeline()
+	for key, value := range values {
+		data, err := c.encode(value)
+		if err != nil {
+			return err
+		}
+
+		pipe.Set(ctx, c.cache.Key(key), data, c.expiration(ttl))
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// SetNX stores the value only if the key is missing, with `SET NX`.
+func (c *Redis[V]) SetNX(ctx context.Context, key string, value V, ttl time.Duration) (bool, error) {
+	data, err := c.encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	return c.client.SetNX(ctx, c.cache.Key(key), data, c.expiration(ttl)).Result()
+}
+
+// CompareAndSwap replaces the value of the key with new only if its encoding is the one of old.
+func (c *Redis[V]) CompareAndSwap(ctx context.Context, key string, old, new V) (bool, error) {
+	oldData, err := c.encode(old)
+	if err != nil {
+		return false, err
+	}
+
+	newData, err := c.encode(new)
+	if err != nil {
+		return false, err
+	}
+
+	swapped, err := compareAndSwapScript.Run(ctx, c.client, []string{c.cache.Key(key)}, oldData, newData).Int()
+
+	return swapped == 1, err
+}
+
+// Increment adds delta to the integer value of the key with `INCRBY`. The values must be stored as decimal text,
+// see Redis.
+func (c *Redis[V]) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	if !c.raw && c.codec != extensions.JSONCodec {
+		return 0, ErrorCacheNotInteger
+	}
+
+	n, err := c.client.IncrBy(ctx, c.cache.Key(key), delta).Result()
+
+	return n, incrementError(err)
+}
+
+// incrementError returns the error of the cache for the errors replied by Redis to INCRBY.
+func incrementError(err error) error {
+	switch {
+	case redis.HasErrorPrefix(err, redisNotInteger):
+		return ErrorCacheNotInteger
+	case redis.HasErrorPrefix(err, redisOverflow):
+		return ErrorCacheOverflow
+	}
+
+	return err
+}
+
+// TTL returns the remaining time-to-live of the key with `PTTL`.
+func (c *Redis[V]) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.PTTL(ctx, c.cache.Key(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// The client keeps the replies of PTTL for a missing key and a key without expiration, -2 and -1, unscaled.
+	switch ttl {
+	case -2:
+		return 0, ErrorCacheMiss
+	case -1:
+		return NoExpiration, nil
+	}
+
+	return ttl, nil
+}
+
+// Delete removes the keys in a single pipeline.
+func (c *Redis[V]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, c.cache.Key(key))
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Exists checks if the key exists.
+func (c *Redis[V]) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.client.Exists(ctx, c.cache.Key(key)).Result()
+
+	return n > 0, err
+}
+
+// Close closes the underlying RedisCache.
+func (c *Redis[V]) Close() error {
+	return c.cache.Close()
+}
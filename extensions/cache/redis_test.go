@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// testRedisError is an error replied by Redis.
+type testRedisError string
+
+func (e testRedisError) Error() string { return string(e) }
+
+func (testRedisError) RedisError() {}
+
+func TestIncrementError(t *testing.T) {
+	other := errors.New("ERR value is not an integer or out of range")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"not an integer", testRedisError("ERR value is not an integer or out of range"), ErrorCacheNotInteger},
+		{"overflow", testRedisError("ERR increment or decrement would overflow"), ErrorCacheOverflow},
+		{"other reply", testRedisError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil},
+		{"not a reply of Redis", other, other},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want == nil {
+				want = tt.err
+			}
+
+			if got := incrementError(tt.err); got != want {
+				t.Errorf("incrementError(%v) = %v, want %v", tt.err, got, want)
+			}
+		})
+	}
+}
+
+func TestRedisCodec(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(t *testing.T)
+	}{
+		{"string with RawCodec", func(t *testing.T) { checkRedisCodec(t, extensions.RawCodec, "5", "5") }},
+		{"bytes with RawCodec", func(t *testing.T) { checkRedisCodec(t, extensions.RawCodec, []byte("5"), "5") }},
+		{"int with RawCodec", func(t *testing.T) { checkRedisCodec(t, extensions.RawCodec, 5, "5") }},
+		{"int with JSONCodec", func(t *testing.T) { checkRedisCodec(t, extensions.JSONCodec, 5, "5") }},
+		{"string with JSONCodec", func(t *testing.T) { checkRedisCodec(t, extensions.JSONCodec, "5", `"5"`) }},
+		{"string with MsgpackCodec", func(t *testing.T) { checkRedisCodec(t, extensions.MsgpackCodec, "5", "") }},
+		{"int with GobCodec", func(t *testing.T) { checkRedisCodec(t, extensions.GobCodec, 5, "") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.check)
+	}
+}
+
+// checkRedisCodec checks the value is stored as wantData, if set, and with the codec of the RedisCache,
+// and that Increment is refused unless the value is decimal text.
+func checkRedisCodec[V any](t *testing.T, codec extensions.Codec, value V, wantData string) {
+	t.Helper()
+
+	encoded, raw := redisCodec[V](codec)
+	c := &Redis[V]{codec: encoded, raw: raw}
+
+	data, err := c.encode(value)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	if wantData != "" && string(data) != wantData {
+		t.Errorf("stored %q, want %q", data, wantData)
+	}
+
+	// The RedisCache decodes what the typed view stored.
+	if codec != extensions.RawCodec {
+		var decoded interface{}
+		if err := codec.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("the RedisCache can't decode %q: %v", data, err)
+		}
+	}
+
+	decoded, err := c.decode(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("decoded %v, want %v", decoded, value)
+	}
+
+	if codec != extensions.RawCodec && codec != extensions.JSONCodec {
+		if _, err := c.Increment(context.Background(), "counter", 1); err != ErrorCacheNotInteger {
+			t.Errorf("Increment with %T error = %v, want %v", codec, err, ErrorCacheNotInteger)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package extensions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// cachedHandler returns a handler behind the response cache, and the number of times the handler ran.
+func cachedHandler(option *CacheOption, handler http.HandlerFunc) (http.HandlerFunc, *int) {
+	calls := 0
+	cache := NewMapCache()
+
+	return NewCacheMiddleware(cache, option).Middleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		handler(w, r)
+	}), &calls
+}
+
+func serveCached(h http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	return w
+}
+
+func TestResponseCacheReplay(t *testing.T) {
+	h, calls := cachedHandler(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Request", r.URL.RawQuery)
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		w.Write([]byte("cached body"))
+	})
+
+	first := serveCached(h, httptest.NewRequest(http.MethodGet, "/items?b=2&a=1", nil))
+	second := serveCached(h, httptest.NewRequest(http.MethodGet, "/items?a=1&b=2", nil))
+	head := serveCached(h, httptest.NewRequest(http.MethodHead, "/items?a=1&b=2", nil))
+
+	if *calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", *calls)
+	}
+
+	if second.Code != first.Code || second.Body.String() != "cached body" {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, "cached body")
+	}
+
+	for _, name := range []string{"Cache-Control", "Content-Type", "X-Request"} {
+		if got, want := second.Header().Get(name), first.Header().Get(name); got != want {
+			t.Errorf("replayed %s = %q, want %q", name, got, want)
+		}
+	}
+
+	if second.Header().Get("Connection") != "" {
+		t.Error("the hop-by-hop Connection header was replayed")
+	}
+
+	if second.Header().Get("Age") != "0" || second.Header().Get("Date") == "" {
+		t.Errorf("Age = %q, Date = %q, want the age and date of the stored response", second.Header().Get("Age"), second.Header().Get("Date"))
+	}
+
+	if head.Code != first.Code || head.Body.Len() != 0 {
+		t.Errorf("HEAD replay = %d %q, want the status without a body", head.Code, head.Body.String())
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	h, calls := cachedHandler(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	})
+
+	requests := []struct {
+		language  string
+		wantCalls int
+	}{
+		{"en", 1},
+		{"fr", 2},
+		{"en", 2},
+		{"fr", 2},
+		{"", 3},
+		{"", 3},
+	}
+
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodGet, "/greeting", nil)
+		if req.language != "" {
+			r.Header.Set("Accept-Language", req.language)
+		}
+
+		w := serveCached(h, r)
+		if w.Body.String() != req.language || *calls != req.wantCalls {
+			t.Errorf("Accept-Language %q = %q after %d calls, want its own variant after %d calls", req.language, w.Body.String(), *calls, req.wantCalls)
+		}
+	}
+
+	// Vary: * can't be matched by a later request.
+	h, calls = cachedHandler(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "*")
+	})
+
+	serveCached(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	serveCached(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if *calls != 2 {
+		t.Errorf("Vary: * response stored, handler ran %d times", *calls)
+	}
+}
+
+func TestResponseCacheStorage(t *testing.T) {
+	tests := []struct {
+		name          string
+		shared        bool
+		cacheControl  string
+		header        string
+		authorization bool
+		status        int
+		wantStored    bool
+	}{
+		{"fresh", true, "max-age=60", "", false, http.StatusOK, true},
+		{"no-store", true, "no-store, max-age=60", "", false, http.StatusOK, false},
+		{"no-cache", true, "no-cache, max-age=60", "", false, http.StatusOK, false},
+		{"private in a shared cache", true, "private, max-age=60", "", false, http.StatusOK, false},
+		{"private in a private cache", false, "private, max-age=60", "", false, http.StatusOK, true},
+		{"Set-Cookie in a shared cache", true, "max-age=60", "Set-Cookie", false, http.StatusOK, false},
+		{"Set-Cookie in a private cache", false, "max-age=60", "Set-Cookie", false, http.StatusOK, true},
+		{"Authorization", true, "max-age=60", "", true, http.StatusOK, false},
+		{"Authorization with public", true, "public, max-age=60", "", true, http.StatusOK, true},
+		{"Authorization with s-maxage", true, "s-maxage=60", "", true, http.StatusOK, true},
+		{"s-maxage over max-age in a shared cache", true, "max-age=0, s-maxage=60", "", false, http.StatusOK, true},
+		{"s-maxage ignored in a private cache", false, "max-age=0, s-maxage=60", "", false, http.StatusOK, false},
+		{"Age beyond max-age", true, "max-age=60", "Age", false, http.StatusOK, false},
+		{"heuristic status", true, "", "", false, http.StatusNotFound, true},
+		{"status without heuristic freshness", true, "", "", false, http.StatusCreated, false},
+		{"explicit freshness", true, "max-age=60", "", false, http.StatusCreated, true},
+		{"encoded without Vary", true, "max-age=60", "Content-Encoding", false, http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, calls := cachedHandler(&CacheOption{Shared: tt.shared}, func(w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+
+				switch tt.header {
+				case "Set-Cookie":
+					w.Header().Set("Set-Cookie", "session=1")
+				case "Age":
+					w.Header().Set("Age", "120")
+				case "Content-Encoding":
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+
+				w.WriteHeader(tt.status)
+			})
+
+			for range 2 {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tt.authorization {
+					r.Header.Set("Authorization", "Bearer token")
+				}
+
+				if w := serveCached(h, r); w.Code != tt.status {
+					t.Fatalf("status = %d, want %d", w.Code, tt.status)
+				}
+			}
+
+			if stored := *calls == 1; stored != tt.wantStored {
+				t.Errorf("stored = %v (handler ran %d times), want %v", stored, *calls, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestResponseCacheAge(t *testing.T) {
+	h, _ := cachedHandler(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Age", "30")
+	})
+
+	serveCached(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	w := serveCached(h, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if age, err := strconv.Atoi(w.Header().Get("Age")); err != nil || age < 30 || age > 31 {
+		t.Errorf("Age = %q, want the age of the response when it was stored", w.Header().Get("Age"))
+	}
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		wantCached   bool
+	}{
+		{"older than max-age", "max-age=10", false},
+		{"within max-age", "max-age=40", true},
+		{"not enough freshness left", "min-fresh=40", false},
+		{"enough freshness left", "min-fresh=10", true},
+		{"no-cache", "no-cache", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, calls := cachedHandler(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Age", "30")
+			})
+
+			serveCached(h, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Cache-Control", tt.cacheControl)
+			serveCached(h, r)
+
+			if cached := *calls == 1; cached != tt.wantCached {
+				t.Errorf("served from the cache = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestResponseCacheInvalidation(t *testing.T) {
+	h, calls := cachedHandler(nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+	})
+
+	serveCached(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+	serveCached(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+	serveCached(h, httptest.NewRequest(http.MethodPost, "/items", nil))
+	serveCached(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	// GET, POST and the GET after the POST invalidated the response.
+	if *calls != 3 {
+		t.Errorf("handler ran %d times, want 3", *calls)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/other", nil)
+	r.Header.Set("Cache-Control", "only-if-cached")
+	if w := serveCached(h, r); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("only-if-cached miss = %d, want 504", w.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package extensions
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the directives of `Cache-Control` headers, keyed by their lowercase name.
+// Directives without a value, like `no-store`, map to an empty string.
+type cacheControl map[string]string
+
+// parseCacheControl parses the directives of the `Cache-Control` header values.
+func parseCacheControl(values []string) cacheControl {
+	cc := make(cacheControl)
+	for _, part := range strings.Split(strings.Join(values, ","), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		cc[name] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive like `max-age`. Invalid values are treated as absent.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+// requestCacheControl returns the `Cache-Control` directives of the request, treating `Pragma: no-cache`
+// as `no-cache` when the request has no `Cache-Control` header.
+func requestCacheControl(r *http.Request) cacheControl {
+	cc := parseCacheControl(r.Header.Values("Cache-Control"))
+	if len(cc) == 0 && strings.Contains(strings.ToLower(r.Header.Get("Pragma")), "no-cache") {
+		cc["no-cache"] = ""
+	}
+
+	return cc
+}
+
+// heuristicallyCacheable are the status codes that can be cached without explicit freshness (RFC 9110 section 15.1).
+var heuristicallyCacheable = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// freshnessLifetime returns the freshness lifetime of a response from `s-maxage` (for shared caches), `max-age`
+// or `Expires`, following RFC 9111 section 4.2.1. It returns false if the response has no explicit freshness.
+func freshnessLifetime(header http.Header, cc cacheControl, shared bool, now time.Time) (time.Duration, bool) {
+	if shared {
+		if lifetime, ok := cc.seconds("s-maxage"); ok {
+			return lifetime, true
+		}
+	}
+
+	if lifetime, ok := cc.seconds("max-age"); ok {
+		return lifetime, true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires, like "0", means already expired.
+			return 0, true
+		}
+
+		date := now
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+
+		return max(expiresAt.Sub(date), 0), true
+	}
+
+	return 0, false
+}
+
+// varyHeaders returns the canonical names of the request headers listed in the `Vary` header values.
+// It returns `*` alone if the response varies on something other than request headers.
+func varyHeaders(values []string) []string {
+	var names []string
+	for _, part := range strings.Split(strings.Join(values, ","), ",") {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			continue
+		}
+
+		if name == "*" {
+			return []string{"*"}
+		}
+
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+
+	return names
+}
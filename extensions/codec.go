@@ -0,0 +1,200 @@
+package extensions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	ErrorCodecCorrupted = errors.New("encoded value is corrupted")
+)
+
+// Codec encodes the values stored by RedisCache. Unmarshal decodes into a pointer, like `*interface{}` when
+// RedisCache.Get returns the value.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// RawCodec stores `[]byte` and `string` values as is, and returns ErrorRedisUnsupportedType for other values.
+	// Values are decoded as `[]byte`. It is the default codec of RedisCache.
+	RawCodec Codec = rawCodec{}
+	// JSONCodec stores values as JSON. Objects are decoded as `map[string]interface{}` and numbers as `float64`.
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec stores values as MessagePack, using the `json` struct tags. Objects are decoded as
+	// `map[string]interface{}`.
+	MsgpackCodec Codec = msgpackCodec{}
+	// GobCodec stores values with encoding/gob, so they are decoded with their own type. Like for any interface value
+	// with gob, the concrete types must be registered with `gob.Register`.
+	GobCodec Codec = gobCodec{}
+)
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+
+	return nil, ErrorRedisUnsupportedType
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = data
+	case *string:
+		*v = string(data)
+	case *interface{}:
+		*v = data
+	default:
+		return ErrorRedisUnsupportedType
+	}
+
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	return dec.Decode(v)
+}
+
+type gobCodec struct{}
+
+// gobValue wraps the values encoded by GobCodec, so gob records their type.
+type gobValue struct {
+	Value interface{}
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobValue{Value: v}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	var value gobValue
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return ErrorRedisUnsupportedType
+	}
+
+	decoded := reflect.ValueOf(value.Value)
+	if !decoded.IsValid() {
+		target.Elem().SetZero()
+		return nil
+	}
+
+	if !decoded.Type().AssignableTo(target.Elem().Type()) {
+		return ErrorRedisUnsupportedType
+	}
+
+	target.Elem().Set(decoded)
+
+	return nil
+}
+
+// Header of the values encoded by CompressCodec.
+const (
+	codecUncompressed byte = iota
+	codecZstd
+)
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		encoder, _ := zstd.NewWriter(nil)
+		return encoder
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		decoder, _ := zstd.NewReader(nil)
+		return decoder
+	})
+)
+
+type compressCodec struct {
+	codec   Codec
+	minSize int
+}
+
+// CompressCodec returns a codec compressing the values encoded by codec with zstd, when they are at least
+// minSize bytes long. The values are prefixed with a byte telling whether they are compressed.
+func CompressCodec(codec Codec, minSize int) Codec {
+	return compressCodec{codec: codec, minSize: minSize}
+}
+
+func (c compressCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < c.minSize {
+		return append([]byte{codecUncompressed}, data...), nil
+	}
+
+	return zstdEncoder().EncodeAll(data, []byte{codecZstd}), nil
+}
+
+func (c compressCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return ErrorCodecCorrupted
+	}
+
+	switch data[0] {
+	case codecUncompressed:
+		return c.codec.Unmarshal(data[1:], v)
+	case codecZstd:
+		decoded, err := zstdDecoder().DecodeAll(data[1:], nil)
+		if err != nil {
+			return err
+		}
+
+		return c.codec.Unmarshal(decoded, v)
+	}
+
+	return ErrorCodecCorrupted
+}
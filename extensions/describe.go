@@ -0,0 +1,51 @@
+package extensions
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+const (
+	DescribeKey contextKey = "describe" // DescribeKey is the context key used to ask typed handlers to describe their types instead of serving the request.
+)
+
+// Description holds the Go types of a route. It is filled by typed handlers and ValidationMiddleware
+// when the request carries DescribeKey, and it is used to generate API documentation.
+type Description struct {
+	Request  reflect.Type // Request is the type the request is bound or decoded into.
+	Response reflect.Type // Response is the type encoded into the response body.
+}
+
+// WithDescription returns a shallow copy of r that asks the handlers to fill d instead of serving the request.
+func WithDescription(r *http.Request, d *Description) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), DescribeKey, d))
+}
+
+// Describe returns the Description carried by the request, if the request is a describe request.
+func Describe(r *http.Request) (*Description, bool) {
+	d, ok := r.Context().Value(DescribeKey).(*Description)
+	return d, ok && d != nil
+}
+
+// describers holds the code pointers of the handlers marked with Describer.
+var describers sync.Map
+
+// Describer marks the handler as implementing the describe protocol and returns it. A describer fills the Description
+// of a describe request and returns without serving it, so it is safe to call when the API documentation is generated.
+// Every handler created by the same function literal is marked, e.g. by every instance of a generic middleware.
+func Describer(handler http.HandlerFunc) http.HandlerFunc {
+	describers.LoadOrStore(reflect.ValueOf(handler).Pointer(), struct{}{})
+	return handler
+}
+
+// IsDescriber reports whether the handler was marked with Describer.
+func IsDescriber(handler http.HandlerFunc) bool {
+	if handler == nil {
+		return false
+	}
+
+	_, ok := describers.Load(reflect.ValueOf(handler).Pointer())
+	return ok
+}
@@ -0,0 +1,633 @@
+package extensions
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"hash/maphash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorDiskValueNil      = errors.New("value cannot be nil")
+	ErrorDiskEntryTooLarge = errors.New("value is larger than the capacity of the cache")
+	ErrorDiskCorrupted     = errors.New("cache log is corrupted")
+	ErrorDiskClosed        = errors.New("cache is closed")
+)
+
+// The log of a DiskCache starts with diskMagic and its version, followed by records of a diskHeaderSize header,
+// the key and the value. The header holds the CRC-32 of the rest of the record, the flags, the key and value lengths
+// and the expiration time. Deleted keys are recorded with a tombstone record without value.
+const (
+	diskMagic      = "MHKD"
+	diskVersion    = 1
+	diskHeaderSize = 4 + 1 + 4 + 4 + 8
+	diskLogName    = "cache.log"
+
+	diskFlagTombstone byte = 1
+)
+
+// DiskCacheOption defines the configuration options for DiskCache.
+type DiskCacheOption struct {
+	// TTL is the default time-to-live of the entries stored with Set.
+	TTL time.Duration
+	// MaxBytes is the maximum size of the live entries on disk. Zero means unbounded. The log may grow up to
+	// about MaxBytes / (1 - CompactRatio) before it is compacted.
+	MaxBytes int64
+	// Policy selects the entries evicted when MaxBytes is reached.
+	Policy EvictionPolicy
+	// CompactInterval is how often expired entries are dropped and the log is compacted if needed.
+	// Zero disables background compaction, see Compact.
+	CompactInterval time.Duration
+	// CompactRatio is the fraction of the log taken by replaced, deleted or expired entries above which it is
+	// rewritten with the live entries only.
+	CompactRatio float64
+	// Sync flushes every write to the disk with fsync. Otherwise the writes of the last moments before a crash
+	// may be lost, but the log is recovered up to the last complete record.
+	Sync bool
+	// Codec encodes the stored values. if nil, RawCodec is used, like for CacheMiddleware.
+	Codec Codec
+}
+
+// DefaultDiskCacheOption provides default values for DiskCache.
+var DefaultDiskCacheOption = DiskCacheOption{
+	TTL:             5 * time.Minute,
+	MaxBytes:        0,
+	Policy:          EvictionLRU,
+	CompactInterval: 1 * time.Minute,
+	CompactRatio:    0.5,
+	Sync:            false,
+	Codec:           RawCodec,
+}
+
+// diskLocation is the place of the record of an entry in the log.
+type diskLocation struct {
+	offset int64
+	size   int64
+}
+
+// DiskCache is a cache persisted in an append-only log on the local disk, for nodes without Redis.
+// Only an index of the keys is held in memory, values are read from the log when they are retrieved,
+// so it can hold large responses for CacheMiddleware. The log is replayed when the cache is opened,
+// so entries survive restarts, and rewritten in the background once enough of it is stale.
+type DiskCache struct {
+	option     DiskCacheOption
+	codec      Codec
+	path       string
+	mutex      sync.Mutex
+	fileMutex  sync.RWMutex // fileMutex is read locked while a value is read, so the log is not closed meanwhile.
+	file       *os.File
+	size       int64 // size is the length of the log.
+	garbage    int64 // garbage is the length of the records of replaced, deleted or expired entries.
+	bytes      int64 // bytes is the length of the records of live entries.
+	items      map[string]*mapItem
+	policy     evictionPolicy
+	seed       maphash.Seed
+	ttl        time.Duration
+	closed     bool
+	stop       chan struct{}
+	closeOnce  sync.Once
+	compacting sync.WaitGroup
+}
+
+// NewDiskCache opens the cache stored in the directory with the default options, creating it if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	return NewDiskCacheWithOption(dir, nil)
+}
+
+// NewDiskCacheWithOption opens the cache stored in the directory with the options, creating it if needed.
+// if option is nil, it uses the default options.
+func NewDiskCacheWithOption(dir string, option *DiskCacheOption) (*DiskCache, error) {
+	if option == nil {
+		option = &DefaultDiskCacheOption
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	codec := option.Codec
+	if codec == nil {
+		codec = RawCodec
+	}
+
+	c := &DiskCache{
+		option: *option,
+		codec:  codec,
+		path:   filepath.Join(dir, diskLogName),
+		items:  make(map[string]*mapItem),
+		policy: newEvictionPolicy(option.Policy, 0),
+		seed:   maphash.MakeSeed(),
+		ttl:    option.TTL,
+		stop:   make(chan struct{}),
+	}
+
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+
+	if option.CompactInterval > 0 {
+		c.compacting.Add(1)
+		go c.startCompactor()
+	}
+
+	return c, nil
+}
+
+// open opens the log and replays it into the index, truncating an incomplete or corrupted last record.
+func (c *DiskCache) open() error {
+	file, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	c.file = file
+	if info.Size() == 0 {
+		if err := c.writeLogHeader(file); err != nil {
+			file.Close()
+			return err
+		}
+
+		c.size = int64(len(diskMagic) + 1)
+		return nil
+	}
+
+	if err := c.replay(info.Size()); err != nil {
+		file.Close()
+		return err
+	}
+
+	evicted := c.evict()
+	if err := c.writeTombstones(evicted); err != nil {
+		file.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (c *DiskCache) writeLogHeader(file *os.File) error {
+	_, err := file.WriteAt(append([]byte(diskMagic), diskVersion), 0)
+
+	return err
+}
+
+// replay rebuilds the index from the log of the given length.
+func (c *DiskCache) replay(length int64) error {
+	if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(c.file, 64*1024)
+
+	magic := make([]byte, len(diskMagic)+1)
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic[:len(diskMagic)]) != diskMagic {
+		return ErrorDiskCorrupted
+	}
+
+	if magic[len(diskMagic)] != diskVersion {
+		return ErrorDiskCorrupted
+	}
+
+	now := time.Now().Unix()
+	offset := int64(len(magic))
+	header := make([]byte, diskHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+
+		flags, keyLen, valueLen, expiresAt := decodeDiskHeader(header)
+		if offset+diskHeaderSize+int64(keyLen)+int64(valueLen) > length {
+			break
+		}
+
+		record := make([]byte, diskHeaderSize+int(keyLen)+int(valueLen))
+		copy(record, header)
+		if _, err := io.ReadFull(reader, record[diskHeaderSize:]); err != nil {
+			break
+		}
+
+		if binary.LittleEndian.Uint32(record) != crc32.ChecksumIEEE(record[4:]) {
+			break
+		}
+
+		key := string(record[diskHeaderSize : diskHeaderSize+keyLen])
+		size := int64(len(record))
+
+		if it, ok := c.items[key]; ok {
+			c.removeItem(it)
+		}
+
+		if flags&diskFlagTombstone != 0 || (expiresAt > 0 && now > expiresAt) {
+			c.garbage += size
+		} else {
+			c.addItem(key, CacheEntry{Value: diskLocation{offset: offset, size: size}, ExpiresAt: expiresAt}, size)
+		}
+
+		offset += size
+	}
+
+	// Records after the last valid one were not completely written, e.g. because of a crash.
+	if err := c.file.Truncate(offset); err != nil {
+		return err
+	}
+
+	c.size = offset
+
+	return nil
+}
+
+func decodeDiskHeader(header []byte) (flags byte, keyLen, valueLen uint32, expiresAt int64) {
+	flags = header[4]
+	keyLen = binary.LittleEndian.Uint32(header[5:])
+	valueLen = binary.LittleEndian.Uint32(header[9:])
+	expiresAt = int64(binary.LittleEndian.Uint64(header[13:]))
+
+	return flags, keyLen, valueLen, expiresAt
+}
+
+func encodeDiskRecord(flags byte, key string, value []byte, expiresAt int64) []byte {
+	record := make([]byte, diskHeaderSize+len(key)+len(value))
+	record[4] = flags
+	binary.LittleEndian.PutUint32(record[5:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[9:], uint32(len(value)))
+	binary.LittleEndian.PutUint64(record[13:], uint64(expiresAt))
+	copy(record[diskHeaderSize:], key)
+	copy(record[diskHeaderSize+len(key):], value)
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+
+	return record
+}
+
+// addItem adds the entry to the index. The cache must be locked.
+func (c *DiskCache) addItem(key string, entry CacheEntry, size int64) {
+	it := &mapItem{key: key, hash: maphash.String(c.seed, key), entry: entry, size: size}
+	c.items[key] = it
+	c.policy.add(it)
+	c.bytes += size
+}
+
+// removeItem removes the entry from the index, its record becoming garbage. The cache must be locked.
+func (c *DiskCache) removeItem(it *mapItem) {
+	delete(c.items, it.key)
+	c.policy.remove(it)
+	c.bytes -= it.size
+	c.garbage += it.size
+}
+
+// evict removes entries from the index until the live entries fit in MaxBytes, returning their keys.
+// The cache must be locked.
+func (c *DiskCache) evict() []string {
+	var evicted []string
+	for c.option.MaxBytes > 0 && c.bytes > c.option.MaxBytes {
+		victim := c.policy.victim()
+		if victim == nil {
+			break
+		}
+
+		c.removeItem(victim)
+		evicted = append(evicted, victim.key)
+	}
+
+	return evicted
+}
+
+// append writes the record at the end of the log, returning its offset. The cache must be locked.
+func (c *DiskCache) append(record []byte) (int64, error) {
+	offset := c.size
+	if _, err := c.file.WriteAt(record, offset); err != nil {
+		// Drop a partially written record, so the next record follows the last complete one.
+		c.file.Truncate(offset)
+		return 0, err
+	}
+
+	if c.option.Sync {
+		// The record is dropped too if it may not be on the disk, so it isn't restored by the next replay
+		// without being in the index now.
+		if err := c.file.Sync(); err != nil {
+			c.file.Truncate(offset)
+			return 0, err
+		}
+	}
+
+	c.size += int64(len(record))
+
+	return offset, nil
+}
+
+// writeTombstones records the deletion of the keys, so they are not restored when the log is replayed.
+// The cache must be locked.
+func (c *DiskCache) writeTombstones(keys []string) error {
+	for _, key := range keys {
+		record := encodeDiskRecord(diskFlagTombstone, key, nil, 0)
+		if _, err := c.append(record); err != nil {
+			return err
+		}
+
+		c.garbage += int64(len(record))
+	}
+
+	return nil
+}
+
+// readValue reads the value of the record of the key at the location of the log.
+func readValue(file *os.File, key string, location diskLocation) ([]byte, error) {
+	record := make([]byte, location.size)
+	if _, err := file.ReadAt(record, location.offset); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(record) != crc32.ChecksumIEEE(record[4:]) {
+		return nil, ErrorDiskCorrupted
+	}
+
+	return record[diskHeaderSize+len(key):], nil
+}
+
+// SetDefaultTTL sets the default time-to-live for cache entries.
+func (c *DiskCache) SetDefaultTTL(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ttl = ttl
+}
+
+// Get retrieves a value from the cache by key, reading it from the disk. The value is read without locking
+// the cache, so reads don't wait for each other nor block the writes.
+func (c *DiskCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+
+	it, ok := c.items[key]
+	if !ok || c.closed {
+		if !c.closed {
+			c.policy.miss(maphash.String(c.seed, key))
+		}
+		c.mutex.Unlock()
+		return nil, false
+	}
+
+	if it.entry.ExpiresAt > 0 && time.Now().Unix() > it.entry.ExpiresAt {
+		c.removeItem(it)
+		c.mutex.Unlock()
+		return nil, false
+	}
+
+	c.policy.access(it)
+	location, file := it.entry.Value.(diskLocation), c.file
+
+	// The log is only replaced or closed with fileMutex locked, after the reads started before.
+	c.fileMutex.RLock()
+	c.mutex.Unlock()
+
+	data, err := readValue(file, key, location)
+	c.fileMutex.RUnlock()
+
+	if err != nil {
+		return nil, false
+	}
+
+	var value interface{}
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Set adds a value to the cache with a default expiration time.
+func (c *DiskCache) Set(key string, value interface{}) error {
+	c.mutex.Lock()
+	ttl := c.ttl
+	c.mutex.Unlock()
+
+	return c.SetWithExpiration(key, value, time.Now().Add(ttl).Unix())
+}
+
+// SetWithExpiration adds a value to the cache with a specific expiration time, zero meaning it never expires.
+// When the cache is full, entries are evicted according to its eviction policy.
+func (c *DiskCache) SetWithExpiration(key string, value interface{}, expiration int64) error {
+	if value == nil {
+		return ErrorDiskValueNil
+	}
+
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	record := encodeDiskRecord(0, key, data, expiration)
+	if c.option.MaxBytes > 0 && int64(len(record)) > c.option.MaxBytes {
+		return ErrorDiskEntryTooLarge
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrorDiskClosed
+	}
+
+	offset, err := c.append(record)
+	if err != nil {
+		return err
+	}
+
+	if it, ok := c.items[key]; ok {
+		c.removeItem(it)
+	}
+
+	size := int64(len(record))
+	c.addItem(key, CacheEntry{Value: diskLocation{offset: offset, size: size}, ExpiresAt: expiration}, size)
+
+	return c.writeTombstones(c.evict())
+}
+
+// Delete removes a value from the cache by key.
+func (c *DiskCache) Delete(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrorDiskClosed
+	}
+
+	it, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+
+	c.removeItem(it)
+
+	return c.writeTombstones([]string{key})
+}
+
+// Exists checks if a key exists in the cache.
+func (c *DiskCache) Exists(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	it, ok := c.items[key]
+
+	return ok && (it.entry.ExpiresAt <= 0 || time.Now().Unix() <= it.entry.ExpiresAt)
+}
+
+// Len returns the number of entries in the cache, including expired entries not removed yet.
+func (c *DiskCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.items)
+}
+
+// Bytes returns the size on disk of the live entries of the cache.
+func (c *DiskCache) Bytes() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.bytes
+}
+
+func (c *DiskCache) startCompactor() {
+	defer c.compacting.Done()
+
+	ticker := time.NewTicker(c.option.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Compact(); err != nil {
+				log.Printf("cache: compacting %s: %v", c.path, err)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Compact drops the expired entries, then rewrites the log with the live entries only if more than CompactRatio
+// of it is stale. The cache is locked while the log is rewritten.
+func (c *DiskCache) Compact() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrorDiskClosed
+	}
+
+	now := time.Now().Unix()
+	for _, it := range c.items {
+		if it.entry.ExpiresAt > 0 && now > it.entry.ExpiresAt {
+			c.removeItem(it)
+		}
+	}
+
+	if c.garbage == 0 || float64(c.garbage) < c.option.CompactRatio*float64(c.size) {
+		return nil
+	}
+
+	return c.rewrite()
+}
+
+// rewrite copies the records of the live entries to a new log, which replaces the current one. The cache must be locked.
+func (c *DiskCache) rewrite() error {
+	tmp := c.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fail := func(err error) error {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := c.writeLogHeader(file); err != nil {
+		return fail(err)
+	}
+
+	writer := bufio.NewWriterSize(file, 64*1024)
+	offset := int64(len(diskMagic) + 1)
+	offsets := make(map[*mapItem]int64, len(c.items))
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	for _, it := range c.items {
+		location := it.entry.Value.(diskLocation)
+		if _, err := io.Copy(writer, io.NewSectionReader(c.file, location.offset, location.size)); err != nil {
+			return fail(err)
+		}
+
+		offsets[it] = offset
+		offset += location.size
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fail(err)
+	}
+
+	if dir, err := os.Open(filepath.Dir(c.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	c.fileMutex.Lock()
+	c.file.Close()
+	c.file = file
+	c.fileMutex.Unlock()
+
+	c.size = offset
+	c.garbage = 0
+
+	for it, offset := range offsets {
+		location := it.entry.Value.(diskLocation)
+		location.offset = offset
+		it.entry.Value = location
+	}
+
+	return nil
+}
+
+// Close stops the compactor, flushes the log to the disk and closes it.
+func (c *DiskCache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		c.compacting.Wait()
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		c.closed = true
+
+		c.fileMutex.Lock()
+		defer c.fileMutex.Unlock()
+
+		err = errors.Join(c.file.Sync(), c.file.Close())
+	})
+
+	return err
+}
@@ -0,0 +1,306 @@
+package extensions
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestDiskCache(t *testing.T, dir string, option *DiskCacheOption) *DiskCache {
+	t.Helper()
+
+	if option == nil {
+		option = &DiskCacheOption{TTL: time.Minute, CompactRatio: 0.5, Codec: RawCodec}
+	}
+
+	c, err := NewDiskCacheWithOption(dir, option)
+	if err != nil {
+		t.Fatalf("NewDiskCacheWithOption: %v", err)
+	}
+
+	return c
+}
+
+func assertDiskValue(t *testing.T, c *DiskCache, key, want string) {
+	t.Helper()
+
+	value, ok := c.Get(key)
+	if want == "" {
+		if ok {
+			t.Errorf("Get(%q) = %q, want a miss", key, value)
+		}
+		return
+	}
+
+	if !ok || string(value.([]byte)) != want {
+		t.Errorf("Get(%q) = %v, %v, want %q", key, value, ok, want)
+	}
+}
+
+func TestDiskCacheReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	c := openTestDiskCache(t, dir, nil)
+	c.Set("kept", "one")
+	c.Set("replaced", "old")
+	c.Set("replaced", "new")
+	c.Set("deleted", "gone")
+	c.Delete("deleted")
+	c.SetWithExpiration("forever", "always", 0)
+	c.SetWithExpiration("expired", "stale", time.Now().Add(-time.Hour).Unix())
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	c = openTestDiskCache(t, dir, nil)
+	defer c.Close()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"kept", "one"},
+		{"replaced", "new"},
+		{"deleted", ""},
+		{"forever", "always"},
+		{"expired", ""},
+		{"missing", ""},
+	}
+
+	for _, tt := range tests {
+		assertDiskValue(t, c, tt.key, tt.want)
+	}
+
+	if got := c.Len(); got != 3 {
+		t.Errorf("Len() = %d, want 3", got)
+	}
+}
+
+func TestDiskCacheReplayDamagedTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, path string)
+	}{
+		{"partial record", func(t *testing.T, path string) {
+			appendFile(t, path, encodeDiskRecord(0, "partial", []byte("value"), 0)[:diskHeaderSize+3])
+		}},
+		{"corrupted record", func(t *testing.T, path string) {
+			record := encodeDiskRecord(0, "corrupted", []byte("value"), 0)
+			record[len(record)-1] ^= 0xff
+			appendFile(t, path, record)
+		}},
+		{"garbage", func(t *testing.T, path string) {
+			appendFile(t, path, []byte("not a record at all, just some bytes"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, diskLogName)
+
+			c := openTestDiskCache(t, dir, nil)
+			c.Set("a", "1")
+			c.Set("b", "2")
+			c.Close()
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.damage(t, path)
+
+			c = openTestDiskCache(t, dir, nil)
+			defer c.Close()
+
+			assertDiskValue(t, c, "a", "1")
+			assertDiskValue(t, c, "b", "2")
+
+			if c.size != info.Size() {
+				t.Errorf("log size after replay = %d, want the damaged tail truncated to %d", c.size, info.Size())
+			}
+
+			// The next record follows the last valid one, so it survives another replay.
+			c.Set("c", "3")
+			c.Close()
+
+			c = openTestDiskCache(t, dir, nil)
+			defer c.Close()
+
+			assertDiskValue(t, c, "c", "3")
+		})
+	}
+}
+
+func TestDiskCacheReplayInvalidHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"magic", []byte("XXXX\x01")},
+		{"version", []byte(diskMagic + "\x02")},
+		{"short", []byte("MH")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, diskLogName), tt.header, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := NewDiskCacheWithOption(dir, nil); err != ErrorDiskCorrupted {
+				t.Errorf("NewDiskCacheWithOption error = %v, want %v", err, ErrorDiskCorrupted)
+			}
+		})
+	}
+}
+
+func TestDiskCacheCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, diskLogName)
+
+	c := openTestDiskCache(t, dir, nil)
+	for round := range 5 {
+		for i := range 20 {
+			c.Set("key"+strconv.Itoa(i), "value "+strconv.Itoa(round))
+		}
+	}
+	for i := 10; i < 20; i++ {
+		c.Delete("key" + strconv.Itoa(i))
+	}
+
+	before := c.size
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	if c.size >= before {
+		t.Errorf("log size after Compact = %d, want less than %d", c.size, before)
+	}
+
+	if c.garbage != 0 {
+		t.Errorf("garbage after Compact = %d, want 0", c.garbage)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != c.size {
+		t.Errorf("log file size = %d, want %d", info.Size(), c.size)
+	}
+
+	// Values are read from their new offsets, before and after a replay of the compacted log.
+	for reopen := range 2 {
+		for i := range 20 {
+			want := ""
+			if i < 10 {
+				want = "value 4"
+			}
+
+			assertDiskValue(t, c, "key"+strconv.Itoa(i), want)
+		}
+
+		if reopen == 0 {
+			c.Set("after", "compaction")
+			c.Close()
+			c = openTestDiskCache(t, dir, nil)
+		}
+	}
+
+	assertDiskValue(t, c, "after", "compaction")
+	c.Close()
+}
+
+func TestDiskCacheCompactBelowRatio(t *testing.T) {
+	c := openTestDiskCache(t, t.TempDir(), nil)
+	defer c.Close()
+
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("a", "3")
+
+	before := c.size
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	if c.size != before {
+		t.Errorf("log size = %d, want the log kept at %d while the garbage is below CompactRatio", c.size, before)
+	}
+}
+
+func TestDiskCacheGetDuringCompact(t *testing.T) {
+	c := openTestDiskCache(t, t.TempDir(), &DiskCacheOption{TTL: time.Minute, CompactRatio: 0.01, Codec: RawCodec})
+	defer c.Close()
+
+	for i := range 50 {
+		c.Set("key"+strconv.Itoa(i), "value "+strconv.Itoa(i))
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for round := range 200 {
+				i := round % 50
+				assertDiskValue(t, c, "key"+strconv.Itoa(i), "value "+strconv.Itoa(i))
+			}
+		}()
+	}
+
+	for round := range 20 {
+		c.Set("churn", strconv.Itoa(round))
+		if err := c.Compact(); err != nil {
+			t.Errorf("Compact: %v", err)
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestDiskCacheEvictionSurvivesReplay(t *testing.T) {
+	dir := t.TempDir()
+	record := int64(len(encodeDiskRecord(0, "key0", []byte("value"), 0)))
+	option := &DiskCacheOption{TTL: time.Minute, MaxBytes: 3 * record, Policy: EvictionLRU, CompactRatio: 0.5, Codec: RawCodec}
+
+	c := openTestDiskCache(t, dir, option)
+	for i := range 5 {
+		c.SetWithExpiration("key"+strconv.Itoa(i), "value", 0)
+	}
+	c.Close()
+
+	c = openTestDiskCache(t, dir, option)
+	defer c.Close()
+
+	for i := range 5 {
+		want := ""
+		if i >= 2 {
+			want = "value"
+		}
+
+		assertDiskValue(t, c, "key"+strconv.Itoa(i), want)
+	}
+}
+
+func appendFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,372 @@
+package extensions
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagOption defines the configuration options for the ETag middleware.
+type ETagOption struct {
+	// Weak makes the computed ETags weak, e.g. `W/"..."`, for responses that are equivalent but not byte-identical.
+	// ETags set by the handler are used as is.
+	Weak bool
+	// Current returns the ETag and modification time of the current representation of the requested resource,
+	// used to check `If-Match` and `If-Unmodified-Since` before running unsafe requests like PUT or DELETE.
+	// It returns false if the resource is unknown, then the handler is expected to check them with CheckPreconditions.
+	Current func(r *http.Request) (etag string, lastModified time.Time, ok bool)
+	// Cache is used to check preconditions of unsafe requests against the response cached for their URL,
+	// when Current is nil or doesn't know the resource.
+	Cache *ResponseCache
+}
+
+// DefaultETagMiddlewareOption provides default values for ETag middleware options.
+var DefaultETagMiddlewareOption = ETagOption{
+	Weak: false,
+}
+
+// ETag is a middleware for conditional requests (RFC 9110 section 13).
+//
+// Successful GET responses get an ETag, the one set by the handler or one computed from the body, and conditional
+// GET and HEAD requests are answered with 304 when `If-None-Match` or `If-Modified-Since` match. When the handler sets
+// `ETag` before writing the body, like cached responses of ResponseCache do, the body is not buffered.
+// Unsafe requests are answered with 412 when `If-Match` or `If-Unmodified-Since` fail against the current
+// representation (see ETagOption.Current and ETagOption.Cache), so clients can detect lost updates.
+type ETag struct {
+	*ETagOption
+}
+
+// NewETagMiddleware creates a new ETag middleware. if option is nil, it uses the default options.
+func NewETagMiddleware(option *ETagOption) *ETag {
+	if option == nil {
+		option = &DefaultETagMiddlewareOption
+	}
+
+	return &ETag{
+		ETagOption: option,
+	}
+}
+
+// ETagMiddleware is a middleware for conditional requests with the default options. See ETag.
+func ETagMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return NewETagMiddleware(nil).Middleware(next)
+}
+
+// Middleware returns an HTTP middleware function that handles conditional requests.
+func (e *ETag) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if etag, lastModified, ok := e.current(r); ok && !CheckPreconditions(w, r, etag, lastModified) {
+				return
+			}
+
+			next(w, r)
+			return
+		}
+
+		ew := &etagWriter{
+			ResponseWriter: w,
+			etag:           e,
+			request:        r,
+		}
+
+		next(ew, r)
+		ew.close()
+	}
+}
+
+// current returns the validators of the current representation from Current, or from the cached response.
+func (e *ETag) current(r *http.Request) (string, time.Time, bool) {
+	if e.Current != nil {
+		if etag, lastModified, ok := e.Current(r); ok {
+			return etag, lastModified, true
+		}
+	}
+
+	if e.Cache != nil {
+		get := *r
+		get.Method = http.MethodGet
+		get.Header = get.Header.Clone()
+		get.Header.Del("Cache-Control")
+
+		if entry, fresh, ok := e.Cache.lookup(e.Cache.key(&get), &get, nil, time.Now()); ok && fresh && entry.Status == http.StatusOK {
+			lastModified, _ := http.ParseTime(entry.Header.Get("Last-Modified"))
+
+			// Without an ETag from the handler, the cached body has the ETag this middleware computed for it.
+			etag := entry.Header.Get("ETag")
+			if etag == "" {
+				etag = e.computeETag(entry.Body)
+			}
+
+			return etag, lastModified, true
+		}
+	}
+
+	return "", time.Time{}, false
+}
+
+// computeETag returns the ETag of the body, a truncated SHA-256 like the ETags of Static.
+func (e *ETag) computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+	if e.Weak {
+		return "W/" + etag
+	}
+
+	return etag
+}
+
+// etagWriter checks the preconditions of a GET or HEAD request once the response validators are known:
+// when the header is written if the handler set an ETag, or at the end of the handler after hashing the body.
+type etagWriter struct {
+	http.ResponseWriter
+	etag        *ETag
+	request     *http.Request
+	status      int
+	buf         bytes.Buffer
+	wroteHeader bool
+	buffering   bool
+	discard     bool
+	hijacked    bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+
+	ew.wroteHeader = true
+	ew.status = code
+
+	if code != http.StatusOK {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if etag := ew.Header().Get("ETag"); etag != "" || ew.request.Method == http.MethodHead {
+		ew.respond(etag)
+		return
+	}
+
+	ew.buffering = true
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	if ew.discard {
+		return len(p), nil
+	}
+
+	if ew.buffering {
+		return ew.buf.Write(p)
+	}
+
+	return ew.ResponseWriter.Write(p)
+}
+
+// respond checks the preconditions against the validators of the response, replying 304 or 412 when they fail
+// and writing the 200 header otherwise.
+func (ew *etagWriter) respond(etag string) {
+	lastModified, _ := http.ParseTime(ew.Header().Get("Last-Modified"))
+
+	switch status := evaluatePreconditions(ew.request, etag, lastModified); status {
+	case http.StatusNotModified:
+		ew.discard = true
+		writeNotModified(ew.ResponseWriter)
+	case http.StatusPreconditionFailed:
+		ew.discard = true
+		http.Error(ew.ResponseWriter, http.StatusText(status), status)
+	default:
+		ew.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+}
+
+// close sends the buffered body, with its computed ETag, unless the request is answered with 304 or 412.
+func (ew *etagWriter) close() {
+	if ew.hijacked {
+		return
+	}
+
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	if !ew.buffering {
+		return
+	}
+
+	ew.buffering = false
+
+	etag := ew.etag.computeETag(ew.buf.Bytes())
+	ew.Header().Set("ETag", etag)
+
+	ew.respond(etag)
+	if !ew.discard && ew.buf.Len() > 0 {
+		ew.ResponseWriter.Write(ew.buf.Bytes())
+	}
+}
+
+// FlushError sends the response written so far. A streamed response gets no computed ETag, as its body is not known yet.
+func (ew *etagWriter) FlushError() error {
+	if ew.hijacked {
+		return http.ErrHijacked
+	}
+
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	if ew.buffering {
+		ew.buffering = false
+		ew.ResponseWriter.WriteHeader(http.StatusOK)
+		if ew.buf.Len() > 0 {
+			if _, err := ew.ResponseWriter.Write(ew.buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return http.NewResponseController(ew.ResponseWriter).Flush()
+}
+
+func (ew *etagWriter) Flush() {
+	ew.FlushError()
+}
+
+// Hijack takes over the connection, used by websockets. It fails once the response is started.
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if ew.wroteHeader {
+		return nil, nil, http.ErrBodyNotAllowed
+	}
+
+	conn, rw, err := http.NewResponseController(ew.ResponseWriter).Hijack()
+	if err == nil {
+		ew.hijacked = true
+	}
+
+	return conn, rw, err
+}
+
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// CheckPreconditions checks the conditional headers of the request against the ETag and modification time
+// of the current representation of the resource, either of which can be empty. If a precondition fails, it replies
+// 304 to GET and HEAD requests, or 412 to the others, and returns false. Otherwise the handler should go on.
+func CheckPreconditions(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	switch status := evaluatePreconditions(r, etag, lastModified); status {
+	case http.StatusNotModified:
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+
+		writeNotModified(w)
+		return false
+	case http.StatusPreconditionFailed:
+		http.Error(w, http.StatusText(status), status)
+		return false
+	}
+
+	return true
+}
+
+// evaluatePreconditions evaluates the conditional headers of the request in the order of RFC 9110 section 13.2.2,
+// returning 304, 412, or zero if the request should be processed.
+func evaluatePreconditions(r *http.Request, etag string, lastModified time.Time) int {
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !matchETag(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.Truncate(time.Second).After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+
+			return http.StatusPreconditionFailed
+		}
+	} else if safe && !lastModified.IsZero() {
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.Truncate(time.Second).After(since) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// matchETag reports whether the list of entity tags of an `If-Match` or `If-None-Match` header matches the ETag,
+// with the weak or strong comparison of RFC 9110 section 8.8.3.2. `*` matches any existing representation.
+func matchETag(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+
+		candidate := header
+		isWeak := strings.HasPrefix(candidate, "W/")
+		candidate = strings.TrimPrefix(candidate, "W/")
+
+		if !strings.HasPrefix(candidate, `"`) {
+			// Not an entity tag, skip to the next element of the list.
+			_, header, _ = strings.Cut(header, ",")
+			continue
+		}
+
+		end := strings.IndexByte(candidate[1:], '"')
+		if end < 0 {
+			return false
+		}
+
+		tag := candidate[:end+2]
+		header = candidate[end+2:]
+
+		if weak {
+			if tag == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !isWeak && !strings.HasPrefix(etag, "W/") && tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeNotModified replies 304, removing the representation headers that don't apply to an empty response.
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	if header.Get("ETag") != "" {
+		header.Del("Last-Modified")
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,188 @@
+package extensions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{`"a"`, `"a"`, false, true},
+		{`"a"`, `"b"`, false, false},
+		{`"b", "a"`, `"a"`, false, true},
+		{`W/"a"`, `"a"`, false, false},
+		{`"a"`, `W/"a"`, false, false},
+		{`W/"a"`, `"a"`, true, true},
+		{`"a"`, `W/"a"`, true, true},
+		{`*`, `"a"`, false, true},
+		{`*`, ``, false, false},
+		{`bogus, "a"`, `"a"`, false, true},
+		{`"a`, `"a"`, false, false},
+		{`"a,b"`, `"a,b"`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header+"|"+tt.etag, func(t *testing.T) {
+			if got := matchETag(tt.header, tt.etag, tt.weak); got != tt.want {
+				t.Errorf("matchETag(%q, %q, %v) = %v, want %v", tt.header, tt.etag, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   int
+	}{
+		{"unconditional", http.MethodGet, nil, 0},
+		{"If-None-Match matches", http.MethodGet, map[string]string{"If-None-Match": `W/"v1"`}, http.StatusNotModified},
+		{"If-None-Match differs", http.MethodGet, map[string]string{"If-None-Match": `"v2"`}, 0},
+		{"If-None-Match on an unsafe request", http.MethodPut, map[string]string{"If-None-Match": `*`}, http.StatusPreconditionFailed},
+		{"If-Modified-Since not modified", http.MethodGet, map[string]string{"If-Modified-Since": after}, http.StatusNotModified},
+		{"If-Modified-Since modified", http.MethodGet, map[string]string{"If-Modified-Since": before}, 0},
+		{"If-None-Match over If-Modified-Since", http.MethodGet, map[string]string{"If-None-Match": `"v2"`, "If-Modified-Since": after}, 0},
+		{"If-Match matches", http.MethodPut, map[string]string{"If-Match": `"v1"`}, 0},
+		{"If-Match differs", http.MethodPut, map[string]string{"If-Match": `"v2"`}, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since modified", http.MethodDelete, map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since unmodified", http.MethodDelete, map[string]string{"If-Unmodified-Since": after}, 0},
+		{"If-Match over If-Unmodified-Since", http.MethodPut, map[string]string{"If-Match": `"v1"`, "If-Unmodified-Since": before}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+
+			if got := evaluatePreconditions(r, `"v1"`, modified); got != tt.want {
+				t.Errorf("evaluatePreconditions = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestETagMiddleware(t *testing.T) {
+	computed := NewETagMiddleware(nil).computeETag([]byte("hello"))
+
+	tests := []struct {
+		name        string
+		method      string
+		handlerETag string
+		ifNoneMatch string
+		wantCode    int
+		wantETag    string
+		wantBody    string
+	}{
+		{"computed ETag", http.MethodGet, "", "", http.StatusOK, computed, "hello"},
+		{"computed ETag matches", http.MethodGet, "", computed, http.StatusNotModified, computed, ""},
+		{"computed ETag differs", http.MethodGet, "", `"old"`, http.StatusOK, computed, "hello"},
+		{"handler ETag", http.MethodGet, `"v1"`, "", http.StatusOK, `"v1"`, "hello"},
+		{"handler ETag matches", http.MethodGet, `"v1"`, `"v1"`, http.StatusNotModified, `"v1"`, ""},
+		{"HEAD", http.MethodHead, `"v1"`, `"v1"`, http.StatusNotModified, `"v1"`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := ETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				if tt.handlerETag != "" {
+					w.Header().Set("ETag", tt.handlerETag)
+				}
+				w.Write([]byte("hello"))
+			})
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantCode || w.Header().Get("ETag") != tt.wantETag || w.Body.String() != tt.wantBody {
+				t.Errorf("response = %d %q %q, want %d %q %q", w.Code, w.Header().Get("ETag"), w.Body.String(), tt.wantCode, tt.wantETag, tt.wantBody)
+			}
+
+			if w.Code == http.StatusNotModified && w.Header().Get("Content-Type") != "" {
+				t.Error("Content-Type kept on a 304")
+			}
+		})
+	}
+
+	// Other statuses are not conditional.
+	handler := ETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", "*")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Errorf("404 response = %d with ETag %q, want it untouched", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestETagUnsafeRequests(t *testing.T) {
+	cache := NewCacheMiddleware(NewMapCache(), nil)
+	etag := NewETagMiddleware(&ETagOption{
+		Current: func(r *http.Request) (string, time.Time, bool) {
+			return `"current"`, time.Time{}, r.URL.Path == "/known"
+		},
+		Cache: cache,
+	})
+
+	get := etag.Middleware(cache.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"cached"`)
+		w.Write([]byte("cached"))
+	}))
+	get(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cached", nil))
+
+	tests := []struct {
+		name     string
+		path     string
+		ifMatch  string
+		wantCode int
+	}{
+		{"Current matches", "/known", `"current"`, http.StatusNoContent},
+		{"Current differs", "/known", `"stale"`, http.StatusPreconditionFailed},
+		{"cached response matches", "/cached", `"cached"`, http.StatusNoContent},
+		{"cached response differs", "/cached", `"stale"`, http.StatusPreconditionFailed},
+		{"unknown resource is left to the handler", "/unknown", `"stale"`, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := etag.Middleware(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			r := httptest.NewRequest(http.MethodPut, tt.path, nil)
+			r.Header.Set("If-Match", tt.ifMatch)
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantCode || called != (tt.wantCode == http.StatusNoContent) {
+				t.Errorf("response = %d, handler called = %v, want %d", w.Code, called, tt.wantCode)
+			}
+		})
+	}
+}
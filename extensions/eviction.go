@@ -0,0 +1,333 @@
+package extensions
+
+import (
+	"container/list"
+)
+
+// EvictionPolicy selects the entries a bounded MapCache evicts when it is full.
+type EvictionPolicy string
+
+const (
+	// EvictionLRU evicts the least recently used entry.
+	EvictionLRU EvictionPolicy = "lru"
+	// EvictionLFU evicts the least frequently used entry, the least recently used one among equals.
+	EvictionLFU EvictionPolicy = "lfu"
+	// EvictionTinyLFU is W-TinyLFU: new entries go through a small LRU window, then are only admitted into the main
+	// segmented LRU if they are used more often than the entry they would replace, estimated with a decaying sketch.
+	// It keeps a better hit ratio than LRU under scans of unique keys.
+	EvictionTinyLFU EvictionPolicy = "tinylfu"
+)
+
+// evictionPolicy orders the items of a shard for eviction. It is guarded by the shard mutex.
+type evictionPolicy interface {
+	// add tracks a new item.
+	add(it *mapItem)
+	// access records a read or an update of the item.
+	access(it *mapItem)
+	// miss records a read of a missing key.
+	miss(hash uint64)
+	// remove stops tracking the item.
+	remove(it *mapItem)
+	// victim returns the item to evict, or nil if there is none.
+	victim() *mapItem
+}
+
+// newEvictionPolicy returns the policy for a shard holding up to capacity items, zero if unbounded.
+func newEvictionPolicy(policy EvictionPolicy, capacity int) evictionPolicy {
+	switch policy {
+	case EvictionLFU:
+		return &lfuPolicy{buckets: make(map[int]*list.List)}
+	case EvictionTinyLFU:
+		return newTinyLFUPolicy(capacity)
+	default:
+		return &lruPolicy{items: list.New()}
+	}
+}
+
+type lruPolicy struct {
+	items *list.List // Most recently used first.
+}
+
+func (p *lruPolicy) add(it *mapItem) {
+	it.element = p.items.PushFront(it)
+}
+
+func (p *lruPolicy) access(it *mapItem) {
+	p.items.MoveToFront(it.element)
+}
+
+func (p *lruPolicy) miss(hash uint64) {}
+
+func (p *lruPolicy) remove(it *mapItem) {
+	p.items.Remove(it.element)
+}
+
+func (p *lruPolicy) victim() *mapItem {
+	if back := p.items.Back(); back != nil {
+		return back.Value.(*mapItem)
+	}
+
+	return nil
+}
+
+// lfuPolicy is an O(1) LFU, with a list of items per frequency, most recently used first.
+type lfuPolicy struct {
+	buckets map[int]*list.List
+	minFreq int
+}
+
+func (p *lfuPolicy) bucket(freq int) *list.List {
+	b, ok := p.buckets[freq]
+	if !ok {
+		b = list.New()
+		p.buckets[freq] = b
+	}
+
+	return b
+}
+
+func (p *lfuPolicy) add(it *mapItem) {
+	it.freq = 1
+	it.element = p.bucket(1).PushFront(it)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) access(it *mapItem) {
+	p.unlink(it)
+	it.freq++
+	it.element = p.bucket(it.freq).PushFront(it)
+}
+
+func (p *lfuPolicy) miss(hash uint64) {}
+
+func (p *lfuPolicy) remove(it *mapItem) {
+	p.unlink(it)
+}
+
+// unlink removes the item from its bucket, dropping the bucket when it is empty.
+func (p *lfuPolicy) unlink(it *mapItem) {
+	b := p.buckets[it.freq]
+	b.Remove(it.element)
+	if b.Len() > 0 {
+		return
+	}
+
+	delete(p.buckets, it.freq)
+	if p.minFreq == it.freq {
+		p.minFreq = 0
+	}
+}
+
+func (p *lfuPolicy) victim() *mapItem {
+	if p.minFreq == 0 {
+		// The lowest bucket was emptied, the number of distinct frequencies is small enough to scan.
+		for freq := range p.buckets {
+			if p.minFreq == 0 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+	}
+
+	if b, ok := p.buckets[p.minFreq]; ok {
+		return b.Back().Value.(*mapItem)
+	}
+
+	return nil
+}
+
+// Segments of the items tracked by tinyLFUPolicy.
+const (
+	segmentWindow uint8 = iota
+	segmentProbation
+	segmentProtected
+)
+
+// tinyLFUPolicy is W-TinyLFU: a window LRU of about 1% of the items in front of a segmented LRU, whose protected
+// segment holds 80% of it. The window victim replaces the main victim only if the sketch estimates it more frequent.
+type tinyLFUPolicy struct {
+	capacity  int // Zero if the shard is only bounded in bytes, then the segments are sized from the item count.
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	sketch    *frequencySketch
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		capacity:  capacity,
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		sketch:    newFrequencySketch(capacity),
+	}
+}
+
+func (p *tinyLFUPolicy) size() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+
+	return p.window.Len() + p.probation.Len() + p.protected.Len()
+}
+
+func (p *tinyLFUPolicy) windowCapacity() int {
+	return max(1, p.size()/100)
+}
+
+func (p *tinyLFUPolicy) protectedCapacity() int {
+	return (p.size() - p.windowCapacity()) * 80 / 100
+}
+
+func (p *tinyLFUPolicy) segment(it *mapItem) *list.List {
+	switch it.segment {
+	case segmentProbation:
+		return p.probation
+	case segmentProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+func (p *tinyLFUPolicy) move(it *mapItem, segment uint8) {
+	p.segment(it).Remove(it.element)
+	it.segment = segment
+	it.element = p.segment(it).PushFront(it)
+}
+
+func (p *tinyLFUPolicy) add(it *mapItem) {
+	p.sketch.increment(it.hash)
+
+	it.segment = segmentWindow
+	it.element = p.window.PushFront(it)
+
+	// While the main segments have room, the window overflows into them without competing.
+	for p.window.Len() > p.windowCapacity() {
+		if p.capacity > 0 && p.probation.Len()+p.protected.Len() >= p.capacity-p.windowCapacity() {
+			break
+		}
+
+		p.move(p.window.Back().Value.(*mapItem), segmentProbation)
+	}
+}
+
+func (p *tinyLFUPolicy) access(it *mapItem) {
+	p.sketch.increment(it.hash)
+
+	switch it.segment {
+	case segmentProbation:
+		p.move(it, segmentProtected)
+
+		for p.protected.Len() > p.protectedCapacity() {
+			p.move(p.protected.Back().Value.(*mapItem), segmentProbation)
+		}
+	default:
+		p.segment(it).MoveToFront(it.element)
+	}
+}
+
+func (p *tinyLFUPolicy) miss(hash uint64) {
+	p.sketch.increment(hash)
+}
+
+func (p *tinyLFUPolicy) remove(it *mapItem) {
+	p.segment(it).Remove(it.element)
+}
+
+func (p *tinyLFUPolicy) mainVictim() *mapItem {
+	if back := p.probation.Back(); back != nil {
+		return back.Value.(*mapItem)
+	}
+
+	if back := p.protected.Back(); back != nil {
+		return back.Value.(*mapItem)
+	}
+
+	return nil
+}
+
+func (p *tinyLFUPolicy) victim() *mapItem {
+	main := p.mainVictim()
+
+	if back := p.window.Back(); back != nil && (main == nil || p.window.Len() > p.windowCapacity()) {
+		candidate := back.Value.(*mapItem)
+		if main == nil {
+			return candidate
+		}
+
+		if p.sketch.estimate(candidate.hash) > p.sketch.estimate(main.hash) {
+			p.move(candidate, segmentProbation)
+			return main
+		}
+
+		return candidate
+	}
+
+	if main != nil {
+		return main
+	}
+
+	if back := p.window.Back(); back != nil {
+		return back.Value.(*mapItem)
+	}
+
+	return nil
+}
+
+// frequencySketch is a count-min sketch of 4 rows of counters saturating at 15. All counters are halved after
+// 10 times as many increments as counters per row, so old popularity fades.
+type frequencySketch struct {
+	counters  []uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// sketchSeeds spread the hash of a key to a different counter in every row.
+var sketchSeeds = [4]uint64{0x9E3779B97F4A7C15, 0xC2B2AE3D27D4EB4F, 0x165667B19E3779F9, 0xD6E8FEB86659FD93}
+
+func newFrequencySketch(capacity int) *frequencySketch {
+	width := 256
+	for width < capacity {
+		width <<= 1
+	}
+
+	return &frequencySketch{
+		counters: make([]uint8, 4*width),
+		mask:     uint64(width - 1),
+		resetAt:  10 * width,
+	}
+}
+
+func (s *frequencySketch) index(hash uint64, row int) int {
+	h := hash * sketchSeeds[row]
+	h ^= h >> 32
+
+	return row*int(s.mask+1) + int(h&s.mask)
+}
+
+func (s *frequencySketch) increment(hash uint64) {
+	for row := range sketchSeeds {
+		if i := s.index(hash, row); s.counters[i] < 15 {
+			s.counters[i]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.counters {
+			s.counters[i] >>= 1
+		}
+
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(hash uint64) uint8 {
+	estimate := uint8(15)
+	for row := range sketchSeeds {
+		estimate = min(estimate, s.counters[s.index(hash, row)])
+	}
+
+	return estimate
+}
@@ -0,0 +1,169 @@
+package extensions
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return h.Sum64()
+}
+
+// runEvictionPolicy applies the operations to the policy, `+key` adding the key, `?key` missing it and `key`
+// accessing it, then returns the keys in the order the policy evicts them.
+func runEvictionPolicy(t *testing.T, p evictionPolicy, ops string) []string {
+	t.Helper()
+
+	items := make(map[string]*mapItem)
+	for _, op := range strings.Fields(ops) {
+		switch {
+		case strings.HasPrefix(op, "+"):
+			it := &mapItem{key: op[1:], hash: testHash(op[1:])}
+			items[it.key] = it
+			p.add(it)
+		case strings.HasPrefix(op, "?"):
+			p.miss(testHash(op[1:]))
+		default:
+			it, ok := items[op]
+			if !ok {
+				t.Fatalf("access to %q before it is added", op)
+			}
+			p.access(it)
+		}
+	}
+
+	var order []string
+	for range items {
+		victim := p.victim()
+		if victim == nil {
+			t.Fatalf("victim is nil with %d items left", len(items)-len(order))
+		}
+
+		p.remove(victim)
+		order = append(order, victim.key)
+	}
+
+	if victim := p.victim(); victim != nil {
+		t.Fatalf("victim of an empty policy = %q, want nil", victim.key)
+	}
+
+	return order
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   EvictionPolicy
+		capacity int
+		ops      string
+		want     []string
+	}{
+		{"lru insertion order", EvictionLRU, 0, "+a +b +c", []string{"a", "b", "c"}},
+		{"lru access refreshes", EvictionLRU, 0, "+a +b +c a", []string{"b", "c", "a"}},
+		{"lru miss is ignored", EvictionLRU, 0, "+a ?a +b", []string{"a", "b"}},
+		{"lfu least frequent first", EvictionLFU, 0, "+a +b +c a a c", []string{"b", "c", "a"}},
+		{"lfu ties evict least recent", EvictionLFU, 0, "+a +b", []string{"a", "b"}},
+		{"lfu new item is least frequent", EvictionLFU, 0, "+a +b a +c", []string{"b", "c", "a"}},
+		{"lfu refilled lowest bucket", EvictionLFU, 0, "+a a a +b b +c", []string{"c", "b", "a"}},
+		{"tinylfu rejects an equally frequent newcomer", EvictionTinyLFU, 3, "+a +b +c +d", []string{"c", "a", "b", "d"}},
+		{"tinylfu admits a frequent newcomer", EvictionTinyLFU, 3, "?c ?c +a +b +c +d", []string{"a", "b", "c", "d"}},
+		{"tinylfu protects accessed items", EvictionTinyLFU, 3, "+a +b +c a +d", []string{"c", "b", "a", "d"}},
+		{"tinylfu without capacity", EvictionTinyLFU, 0, "+a +b", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runEvictionPolicy(t, newEvictionPolicy(tt.policy, tt.capacity), tt.ops)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("eviction order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrequencySketch(t *testing.T) {
+	s := newFrequencySketch(0)
+
+	hot, cold := testHash("hot"), testHash("cold")
+	for range 20 {
+		s.increment(hot)
+	}
+	s.increment(cold)
+
+	if got := s.estimate(hot); got != 15 {
+		t.Errorf("estimate of a saturated key = %d, want 15", got)
+	}
+
+	if got := s.estimate(cold); got != 1 {
+		t.Errorf("estimate of a key seen once = %d, want 1", got)
+	}
+
+	// Reaching resetAt halves every counter.
+	for i := 0; s.additions < s.resetAt-1; i++ {
+		s.increment(testHash(strconv.Itoa(i)))
+	}
+	s.increment(testHash("last"))
+
+	if got := s.estimate(hot); got > 8 {
+		t.Errorf("estimate after the reset = %d, want at most 8", got)
+	}
+}
+
+func TestMapCacheShards(t *testing.T) {
+	tests := []struct {
+		shards     int
+		maxEntries int
+		want       int
+	}{
+		{16, 0, 16},
+		{10, 0, 16},
+		{16, 10, 1},
+		{16, 127, 1},
+		{16, 128, 2},
+		{16, 1000, 8},
+		{16, 1 << 20, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.shards)+"/"+strconv.Itoa(tt.maxEntries), func(t *testing.T) {
+			c := NewMapCacheWithOption(&MapCacheOption{Shards: tt.shards, MaxEntries: tt.maxEntries})
+			defer c.Close()
+
+			if got := len(c.shards); got != tt.want {
+				t.Errorf("shards = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapCacheMaxEntries(t *testing.T) {
+	var evicted []string
+	c := NewMapCacheWithOption(&MapCacheOption{
+		Shards:     16,
+		MaxEntries: 10,
+		Policy:     EvictionLRU,
+		OnEvict: func(key string, value interface{}, reason EvictionReason) {
+			evicted = append(evicted, key)
+		},
+	})
+	defer c.Close()
+
+	for i := range 10 {
+		c.Set(strconv.Itoa(i), i)
+	}
+
+	if c.Len() != 10 || len(evicted) > 0 {
+		t.Fatalf("len = %d, evicted = %v, want 10 entries before reaching MaxEntries", c.Len(), evicted)
+	}
+
+	c.Set("10", 10)
+	if c.Len() != 10 || !slices.Equal(evicted, []string{"0"}) {
+		t.Errorf("len = %d, evicted = %v, want the least recently used entry evicted", c.Len(), evicted)
+	}
+}
@@ -0,0 +1,337 @@
+package extensions
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// HEADER_CACHE_TAG lists the tags of a response, separated by commas or spaces. ResponseCache tags the stored
+	// response with them, and the tags of a successful unsafe request are invalidated. It is not sent to clients.
+	HEADER_CACHE_TAG = "Cache-Tag"
+	// HEADER_CACHE_PREFIX and HEADER_CACHE_PATTERN select the entries deleted by a BAN request, see PurgeMiddleware.
+	HEADER_CACHE_PREFIX  = "Cache-Prefix"
+	HEADER_CACHE_PATTERN = "Cache-Pattern"
+
+	METHOD_PURGE = "PURGE"
+	METHOD_BAN   = "BAN"
+)
+
+var (
+	ErrorCacheInvalidationUnsupported = errors.New("cache does not support invalidation by tag, prefix or pattern")
+)
+
+// Invalidator is implemented by caches that can delete entries by tag, prefix or pattern, like MapCache and RedisCache.
+// Patterns are globs like the ones of Redis `SCAN MATCH`: `*` matches any characters, `?` one character,
+// `[abc]` or `[a-z]` a character of the set, and `\` escapes the next character.
+type Invalidator interface {
+	// Tag associates the tags with the stored key.
+	Tag(key string, tags ...string) error
+	// InvalidateTags deletes the entries associated with any of the tags, returning the number of deleted entries.
+	InvalidateTags(tags ...string) (int, error)
+	// InvalidatePrefix deletes the entries whose key starts with the prefix, returning the number of deleted entries.
+	InvalidatePrefix(prefix string) (int, error)
+	// InvalidatePattern deletes the entries whose key matches the pattern, returning the number of deleted entries.
+	InvalidatePattern(pattern string) (int, error)
+}
+
+// AddCacheTags tags the response, so ResponseCache can invalidate it with InvalidateTags.
+// For example, `/api/users/1` could be tagged with `user:1` and `users`.
+func AddCacheTags(w http.ResponseWriter, tags ...string) {
+	w.Header().Add(HEADER_CACHE_TAG, strings.Join(tags, ","))
+}
+
+// cacheTags returns the tags listed in the values of HEADER_CACHE_TAG.
+func cacheTags(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		tags = append(tags, strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' '
+		})...)
+	}
+
+	return tags
+}
+
+// InvalidateTags deletes the cached responses tagged with any of the tags.
+func (c *ResponseCache) InvalidateTags(tags ...string) (int, error) {
+	invalidator, ok := c.cache.(Invalidator)
+	if !ok {
+		return 0, ErrorCacheInvalidationUnsupported
+	}
+
+	return invalidator.InvalidateTags(tags...)
+}
+
+// InvalidatePrefix deletes the cached responses whose key starts with the prefix, e.g. `GET:/api/users`.
+func (c *ResponseCache) InvalidatePrefix(prefix string) (int, error) {
+	invalidator, ok := c.cache.(Invalidator)
+	if !ok {
+		return 0, ErrorCacheInvalidationUnsupported
+	}
+
+	return invalidator.InvalidatePrefix(prefix)
+}
+
+// InvalidatePattern deletes the cached responses whose key matches the pattern, e.g. `GET:/api/users/*`.
+func (c *ResponseCache) InvalidatePattern(pattern string) (int, error) {
+	invalidator, ok := c.cache.(Invalidator)
+	if !ok {
+		return 0, ErrorCacheInvalidationUnsupported
+	}
+
+	return invalidator.InvalidatePattern(pattern)
+}
+
+// Purge deletes the cached response for the URL of the request, with all its variants.
+func (c *ResponseCache) Purge(r *http.Request) (int, error) {
+	get := *r
+	get.Method = http.MethodGet
+	key := c.key(&get)
+
+	n := 0
+	if c.cache.Exists(key) {
+		if err := c.cache.Delete(key); err != nil {
+			return 0, err
+		}
+
+		n++
+	}
+
+	// Variants are stored under the key followed by the values of the request headers they vary on.
+	if invalidator, ok := c.cache.(Invalidator); ok {
+		variants, err := invalidator.InvalidatePrefix(key + "\x00")
+		if err != nil {
+			return n, err
+		}
+
+		n += variants
+	}
+
+	return n, nil
+}
+
+// PurgeOption defines the configuration options for the purge middleware. Purge requests are forbidden
+// unless Token or Authorize is set.
+type PurgeOption struct {
+	// Token is the bearer token expected in the `Authorization` header of purge requests.
+	Token string
+	// Authorize authorizes purge requests, it is used instead of Token when set.
+	Authorize func(r *http.Request) bool
+}
+
+// PurgeMiddleware returns a middleware answering the PURGE and BAN requests of authorized clients, to invalidate
+// cached responses. Register it on the server with Use, so it sees requests for any path. Other requests go through.
+//
+// `PURGE /api/users/1` deletes the cached response of the URL. `BAN` deletes the responses tagged with one of the tags
+// of the `Cache-Tag` header, or whose key starts with the `Cache-Prefix` header or matches the `Cache-Pattern` header.
+// It replies with the number of deleted entries as JSON, e.g. `{"purged":2}`.
+func (c *ResponseCache) PurgeMiddleware(option *PurgeOption) func(http.HandlerFunc) http.HandlerFunc {
+	if option == nil {
+		option = &PurgeOption{}
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != METHOD_PURGE && r.Method != METHOD_BAN {
+				next(w, r)
+				return
+			}
+
+			if !option.authorized(r) {
+				if option.Authorize == nil && option.Token != "" {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="cache"`)
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			var n int
+			var err error
+			if r.Method == METHOD_PURGE {
+				n, err = c.Purge(r)
+			} else {
+				n, err = c.ban(r)
+			}
+
+			switch {
+			case errors.Is(err, ErrorCacheInvalidationUnsupported):
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+				return
+			case errors.Is(err, errorBanCriteria):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]int{"purged": n})
+		}
+	}
+}
+
+var errorBanCriteria = errors.New("BAN requires a Cache-Tag, Cache-Prefix or Cache-Pattern header")
+
+// ban deletes the entries selected by the headers of a BAN request.
+func (c *ResponseCache) ban(r *http.Request) (int, error) {
+	tags := cacheTags(r.Header.Values(HEADER_CACHE_TAG))
+	prefix := r.Header.Get(HEADER_CACHE_PREFIX)
+	pattern := r.Header.Get(HEADER_CACHE_PATTERN)
+
+	if len(tags) == 0 && prefix == "" && pattern == "" {
+		return 0, errorBanCriteria
+	}
+
+	total := 0
+	if len(tags) > 0 {
+		n, err := c.InvalidateTags(tags...)
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+	}
+
+	if prefix != "" {
+		n, err := c.InvalidatePrefix(prefix)
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+	}
+
+	if pattern != "" {
+		n, err := c.InvalidatePattern(pattern)
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+func (o *PurgeOption) authorized(r *http.Request) bool {
+	if o.Authorize != nil {
+		return o.Authorize(r)
+	}
+
+	if o.Token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+o.Token)) == 1
+}
+
+// matchGlob reports whether s matches the glob pattern, with the syntax of Redis patterns (see Invalidator).
+func matchGlob(pattern, s string) bool {
+	// star and backtrack are the positions to resume from when the text after the last `*` fails to match.
+	star, backtrack := -1, 0
+
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, backtrack = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern[p:], s[i]); end > 0 {
+					if ok {
+						p += end
+						i++
+						continue
+					}
+				} else if s[i] == '[' {
+					p++
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+
+		backtrack++
+		p, i = star+1, backtrack
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchClass matches the character against the class at the start of the pattern, like `[a-z]` or `[^0-9]`.
+// It returns the length of the class, zero if it is not closed.
+func matchClass(pattern string, c byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+
+	if i >= len(pattern) {
+		return 0, false
+	}
+
+	return i + 1, matched != negate
+}
+
+// escapeGlob escapes the special characters of glob patterns, so the string only matches itself.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
@@ -0,0 +1,95 @@
+package extensions
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"users", "users", true},
+		{"users", "user", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"users:*", "users:42", true},
+		{"users:*", "posts:42", false},
+		{"*:42", "users:42", true},
+		{"*:42:*", "users:42:profile", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"a*bc", "abcbc", true},
+		{"user?", "users", true},
+		{"user?", "user", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[b-a]llo", "hallo", true},
+		{"h[allo", "h[allo", true},
+		{"h[allo", "hallo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`h\?llo`, "h?llo", true},
+		{`\[a]`, "[a]", true},
+		{"*[0-9]", "users:7", true},
+		{"*[0-9]", "users:x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.s, func(t *testing.T) {
+			if got := matchGlob(tt.pattern, tt.s); got != tt.want {
+				t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchClass(t *testing.T) {
+	tests := []struct {
+		pattern string
+		c       byte
+		wantLen int
+		wantOk  bool
+	}{
+		{"[abc]", 'b', 5, true},
+		{"[abc]", 'd', 5, false},
+		{"[a-z]rest", 'q', 5, true},
+		{"[a-z]", 'Q', 5, false},
+		{"[z-a]", 'q', 5, true},
+		{"[^0-9]", 'a', 6, true},
+		{"[^0-9]", '5', 6, false},
+		{`[\]]`, ']', 4, true},
+		{`[\-]`, '-', 4, true},
+		{"[a-]", '-', 4, true},
+		{"[]", 'a', 2, false},
+		{"[abc", 'a', 0, false},
+		{"[", 'a', 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+string(tt.c), func(t *testing.T) {
+			gotLen, gotOk := matchClass(tt.pattern, tt.c)
+			if gotLen != tt.wantLen || gotOk != tt.wantOk {
+				t.Errorf("matchClass(%q, %q) = (%d, %v), want (%d, %v)", tt.pattern, tt.c, gotLen, gotOk, tt.wantLen, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	for _, s := range []string{"users", "a*b", "what?", "[x]", `back\slash`, "*[?]\\"} {
+		if !matchGlob(escapeGlob(s), s) {
+			t.Errorf("escapeGlob(%q) does not match itself", s)
+		}
+
+		if matchGlob(escapeGlob(s), s+"x") {
+			t.Errorf("escapeGlob(%q) matches a longer string", s)
+		}
+	}
+}
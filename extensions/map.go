@@ -1,131 +1,576 @@
 package extensions
 
 import (
+	"container/list"
 	"errors"
+	"hash/maphash"
+	"log"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// MapCache is a simple in-memory cache implementation using a map.
+var (
+	ErrorMapValueNil      = errors.New("value cannot be nil")
+	ErrorMapEntryTooLarge = errors.New("value is larger than the capacity of the cache")
+)
+
+// EvictionReason tells why an entry was removed from a MapCache.
+type EvictionReason string
+
+const (
+	EvictedByCapacity   EvictionReason = "capacity"   // The cache was full.
+	EvictedByExpiration EvictionReason = "expiration" // The entry expired.
+	EvictedByDelete     EvictionReason = "delete"     // The entry was deleted with Delete.
+	EvictedByReplace    EvictionReason = "replace"    // The entry was overwritten by Set.
+	EvictedByInvalidate EvictionReason = "invalidate" // The entry was deleted by tag, prefix or pattern.
+)
+
+// mapEntryOverhead is the estimated memory of an entry besides its key and value: the item, its map slot
+// and its list element.
+const mapEntryOverhead = 128
+
+// minShardEntries is the fewest entries a shard of a bounded cache holds. As every shard evicts on its own,
+// smaller shards would evict long before MaxEntries when the keys are not spread evenly.
+const minShardEntries = 64
+
+// MapCacheOption defines the configuration options for MapCache.
+type MapCacheOption struct {
+	// TTL is the default time-to-live of the entries stored with Set.
+	TTL time.Duration
+	// CleanupInterval is how often expired entries are removed. Zero disables the cleaner, expired entries are then
+	// only removed when they are read or evicted.
+	CleanupInterval time.Duration
+	// Shards is the number of independently locked parts of the cache, rounded up to a power of two.
+	// The limits are split equally between the shards, rounded up, and every shard evicts on its own, so the limits
+	// are approximate: a full cache may hold a few more entries, or evict before a limit when the keys are not spread
+	// evenly. With MaxEntries, the shards are reduced so each holds at least 64 entries, so a cache of fewer than
+	// 128 entries has a single shard and an exact limit.
+	Shards int
+	// MaxEntries is the maximum number of entries. Zero means unbounded.
+	MaxEntries int
+	// MaxBytes is the maximum estimated memory of the entries, see Sizer. Zero means unbounded.
+	MaxBytes int64
+	// Policy selects the entries evicted when a limit is reached.
+	Policy EvictionPolicy
+	// Sizer returns the size in bytes of an entry. if nil, the size is the length of the key and of `[]byte`
+	// or `string` values, plus a fixed overhead.
+	Sizer func(key string, value interface{}) int64
+	// OnEvict is called with every entry removed from the cache and the reason, outside of the cache locks.
+	OnEvict func(key string, value interface{}, reason EvictionReason)
+	// SnapshotPath is the file the cache is restored from when it is created, if it exists, and saved to when it is
+	// closed, so restarts don't begin with an empty cache. See Snapshot.
+	SnapshotPath string
+	// SnapshotInterval is how often the cache is saved to SnapshotPath. Zero only saves it when it is closed.
+	SnapshotInterval time.Duration
+	// SnapshotCodec encodes the values in snapshots. if nil, GobCodec is used, so values keep their type,
+	// as long as it is registered with `gob.Register`.
+	SnapshotCodec Codec
+}
+
+// DefaultMapCacheOption provides default values for MapCache, an unbounded cache like the one of NewMapCache.
+var DefaultMapCacheOption = MapCacheOption{
+	TTL:             5 * time.Minute,
+	CleanupInterval: 1 * time.Minute,
+	Shards:          16,
+	MaxEntries:      0,
+	MaxBytes:        0,
+	Policy:          EvictionLRU,
+}
+
+// MapCache is an in-memory cache, sharded to reduce lock contention and optionally bounded in entries and bytes.
 type MapCache struct {
-	data        map[string]CacheEntry
-	mutex       sync.RWMutex
-	ttl         time.Duration
-	cleaner     *time.Ticker
-	stopCleaner chan struct{}
+	option    MapCacheOption
+	shards    []*mapShard
+	seed      maphash.Seed
+	ttl       atomic.Int64
+	cleaner   *time.Ticker
+	stop      chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+	tagMutex  sync.Mutex
+	tags      map[string]map[string]struct{} // tags holds the keys of every tag.
+	keyTags   map[string][]string            // keyTags holds the tags of every tagged key.
+}
+
+// mapItem is an entry of a shard, tracked by the eviction policy of the shard.
+type mapItem struct {
+	key     string
+	hash    uint64
+	entry   CacheEntry
+	size    int64
+	element *list.Element
+	segment uint8 // segment is the W-TinyLFU segment of the item.
+	freq    int   // freq is the LFU frequency of the item.
+}
+
+// evictedItem is an entry removed from a shard, reported to OnEvict once the shard is unlocked.
+type evictedItem struct {
+	key    string
+	value  interface{}
+	reason EvictionReason
+}
+
+type mapShard struct {
+	mutex      sync.Mutex
+	items      map[string]*mapItem
+	policy     evictionPolicy
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
 }
 
 // Create a new MapCache instance with a default TTL.
 func NewMapCache() *MapCache {
+	return NewMapCacheWithOption(nil)
+}
+
+// NewMapCacheWithOption creates a new MapCache with the options. if option is nil, it uses the default options.
+func NewMapCacheWithOption(option *MapCacheOption) *MapCache {
+	if option == nil {
+		option = &DefaultMapCacheOption
+	}
+
+	shards := 1
+	for shards < option.Shards {
+		shards <<= 1
+	}
+
+	for option.MaxEntries > 0 && shards > 1 && option.MaxEntries/shards < minShardEntries {
+		shards >>= 1
+	}
+
 	c := &MapCache{
-		data:        make(map[string]CacheEntry),
-		ttl:         5 * time.Minute,
-		cleaner:     time.NewTicker(1 * time.Minute),
-		stopCleaner: make(chan struct{}),
+		option:  *option,
+		shards:  make([]*mapShard, shards),
+		seed:    maphash.MakeSeed(),
+		stop:    make(chan struct{}),
+		tags:    make(map[string]map[string]struct{}),
+		keyTags: make(map[string][]string),
+	}
+
+	c.ttl.Store(int64(option.TTL))
+
+	maxEntries, maxBytes := 0, int64(0)
+	if option.MaxEntries > 0 {
+		maxEntries = (option.MaxEntries + shards - 1) / shards
 	}
 
-	go c.startCleaner()
+	if option.MaxBytes > 0 {
+		maxBytes = (option.MaxBytes + int64(shards) - 1) / int64(shards)
+	}
+
+	for i := range c.shards {
+		c.shards[i] = &mapShard{
+			items:      make(map[string]*mapItem),
+			policy:     newEvictionPolicy(option.Policy, maxEntries),
+			maxEntries: maxEntries,
+			maxBytes:   maxBytes,
+		}
+	}
+
+	if option.CleanupInterval > 0 {
+		c.cleaner = time.NewTicker(option.CleanupInterval)
+		go c.startCleaner()
+	}
+
+	if option.SnapshotPath != "" {
+		if err := c.RestoreFile(option.SnapshotPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("cache: restoring %s: %v", option.SnapshotPath, err)
+		}
+
+		if option.SnapshotInterval > 0 {
+			c.running.Add(1)
+			go c.startSnapshots()
+		}
+	}
 
 	return c
 }
 
 func (c *MapCache) startCleaner() {
-	go func() {
-		for {
-			select {
-			case <-c.cleaner.C:
-				c.mutex.Lock()
-				now := time.Now().Unix()
-				for key, entry := range c.data {
-					if entry.ExpiresAt > 0 && now > entry.ExpiresAt {
-						delete(c.data, key)
+	for {
+		select {
+		case <-c.cleaner.C:
+			now := time.Now().Unix()
+			for _, s := range c.shards {
+				s.mutex.Lock()
+				var evicted []evictedItem
+				for _, it := range s.items {
+					if it.entry.ExpiresAt > 0 && now > it.entry.ExpiresAt {
+						evicted = append(evicted, s.remove(it, EvictedByExpiration))
 					}
 				}
-				c.mutex.Unlock()
-			case <-c.stopCleaner:
-				return
+				s.mutex.Unlock()
+
+				c.notify(evicted)
 			}
+		case <-c.stop:
+			return
 		}
-	}()
+	}
+}
+
+func (c *MapCache) hash(key string) uint64 {
+	return maphash.String(c.seed, key)
+}
+
+func (c *MapCache) shard(hash uint64) *mapShard {
+	return c.shards[hash&uint64(len(c.shards)-1)]
+}
+
+func (c *MapCache) size(key string, value interface{}) int64 {
+	if c.option.Sizer != nil {
+		return c.option.Sizer(key, value)
+	}
+
+	size := int64(len(key) + mapEntryOverhead)
+	switch v := value.(type) {
+	case []byte:
+		size += int64(len(v))
+	case string:
+		size += int64(len(v))
+	}
+
+	return size
+}
+
+// notify drops the tags of the evicted entries and reports them to OnEvict.
+func (c *MapCache) notify(evicted []evictedItem) {
+	if len(evicted) == 0 {
+		return
+	}
+
+	c.tagMutex.Lock()
+	for _, e := range evicted {
+		c.untag(e.key)
+	}
+	c.tagMutex.Unlock()
+
+	if c.option.OnEvict == nil {
+		return
+	}
+
+	for _, e := range evicted {
+		c.option.OnEvict(e.key, e.value, e.reason)
+	}
+}
+
+// untag removes the key from its tags. The tag mutex must be locked.
+func (c *MapCache) untag(key string) {
+	for _, tag := range c.keyTags[key] {
+		if keys, ok := c.tags[tag]; ok {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+
+	delete(c.keyTags, key)
+}
+
+// remove removes the item from the shard. The shard must be locked.
+func (s *mapShard) remove(it *mapItem, reason EvictionReason) evictedItem {
+	delete(s.items, it.key)
+	s.policy.remove(it)
+	s.bytes -= it.size
+
+	return evictedItem{key: it.key, value: it.entry.Value, reason: reason}
+}
+
+// set stores the entry and evicts entries until the shard is within its limits. The shard must be locked.
+func (s *mapShard) set(key string, hash uint64, entry CacheEntry, size int64) ([]evictedItem, error) {
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return nil, ErrorMapEntryTooLarge
+	}
+
+	var evicted []evictedItem
+	if it, ok := s.items[key]; ok {
+		evicted = append(evicted, evictedItem{key: key, value: it.entry.Value, reason: EvictedByReplace})
+
+		s.bytes += size - it.size
+		it.entry, it.size = entry, size
+		s.policy.access(it)
+	} else {
+		it := &mapItem{key: key, hash: hash, entry: entry, size: size}
+		s.items[key] = it
+		s.bytes += size
+		s.policy.add(it)
+	}
+
+	for (s.maxEntries > 0 && len(s.items) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		victim := s.policy.victim()
+		if victim == nil {
+			break
+		}
+
+		evicted = append(evicted, s.remove(victim, EvictedByCapacity))
+	}
+
+	return evicted, nil
 }
 
 // SetDefaultTTL sets the default time-to-live for cache entries.
 func (c *MapCache) SetDefaultTTL(ttl time.Duration) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.ttl.Store(int64(ttl))
+}
 
-	c.ttl = ttl
+// DefaultTTL returns the default time-to-live of the entries stored with Set.
+func (c *MapCache) DefaultTTL() time.Duration {
+	return time.Duration(c.ttl.Load())
 }
 
 // Get retrieves a value from the cache by key.
 func (c *MapCache) Get(key string) (interface{}, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	entry, ok := c.GetEntry(key)
+
+	return entry.Value, ok
+}
+
+// GetEntry retrieves the entry of the key, with its expiration time.
+func (c *MapCache) GetEntry(key string) (CacheEntry, bool) {
+	hash := c.hash(key)
+	s := c.shard(hash)
 
-	entry, exists := c.data[key]
-	if !exists || (entry.ExpiresAt > 0 && time.Now().Unix() > entry.ExpiresAt) {
-		return nil, false
+	s.mutex.Lock()
+	it, exists := s.items[key]
+	if !exists {
+		s.policy.miss(hash)
+		s.mutex.Unlock()
+		return CacheEntry{}, false
 	}
 
-	return entry.Value, true
+	if it.entry.ExpiresAt > 0 && time.Now().Unix() > it.entry.ExpiresAt {
+		evicted := s.remove(it, EvictedByExpiration)
+		s.mutex.Unlock()
+
+		c.notify([]evictedItem{evicted})
+		return CacheEntry{}, false
+	}
+
+	s.policy.access(it)
+	entry := it.entry
+	s.mutex.Unlock()
+
+	return entry, true
 }
 
 // Set adds a value to the cache with a default expiration time.
 func (c *MapCache) Set(key string, value interface{}) error {
 	if value == nil {
-		return errors.New("value cannot be nil")
+		return ErrorMapValueNil
 	}
 
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	expiration := time.Now().Add(time.Duration(c.ttl.Load()))
 
-	expiration := time.Now().Add(c.ttl)
-	c.data[key] = CacheEntry{
-		Value:     value,
-		ExpiresAt: expiration.Unix(),
-	}
-
-	return nil
+	return c.SetWithExpiration(key, value, expiration.Unix())
 }
 
 // SetWithExpiration adds a value to the cache with a specific expiration time.
+// When the cache is full, entries are evicted according to its eviction policy.
 func (c *MapCache) SetWithExpiration(key string, value interface{}, expiration int64) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	hash := c.hash(key)
+	size := c.size(key, value)
+	s := c.shard(hash)
+
+	s.mutex.Lock()
+	evicted, err := s.set(key, hash, CacheEntry{Value: value, ExpiresAt: expiration}, size)
+	s.mutex.Unlock()
+
+	c.notify(evicted)
 
-	c.data[key] = CacheEntry{
-		Value:     value,
-		ExpiresAt: expiration,
+	return err
+}
+
+// Update atomically replaces the entry of the key with the one returned by fn, which is called with the current
+// entry and whether it exists. The entry is left as is when fn returns false. fn runs with the key locked,
+// so it must not use the cache.
+func (c *MapCache) Update(key string, fn func(entry CacheEntry, ok bool) (CacheEntry, bool)) error {
+	hash := c.hash(key)
+	s := c.shard(hash)
+
+	s.mutex.Lock()
+	var evicted []evictedItem
+
+	current, exists := CacheEntry{}, false
+	if it, ok := s.items[key]; ok {
+		if it.entry.ExpiresAt > 0 && time.Now().Unix() > it.entry.ExpiresAt {
+			evicted = append(evicted, s.remove(it, EvictedByExpiration))
+		} else {
+			current, exists = it.entry, true
+		}
 	}
 
-	return nil
+	entry, store := fn(current, exists)
+
+	var err error
+	switch {
+	case !store:
+	case entry.Value == nil:
+		err = ErrorMapValueNil
+	default:
+		var replaced []evictedItem
+		replaced, err = s.set(key, hash, entry, c.size(key, entry.Value))
+		evicted = append(evicted, replaced...)
+	}
+	s.mutex.Unlock()
+
+	c.notify(evicted)
+
+	return err
 }
 
 // Delete removes a value from the cache by key.
 func (c *MapCache) Delete(key string) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	s := c.shard(c.hash(key))
+
+	s.mutex.Lock()
+	it, exists := s.items[key]
+	if !exists {
+		s.mutex.Unlock()
+		return nil
+	}
 
-	delete(c.data, key)
+	evicted := s.remove(it, EvictedByDelete)
+	s.mutex.Unlock()
+
+	c.notify([]evictedItem{evicted})
 
 	return nil
 }
 
 // Exists checks if a key exists in the cache.
 func (c *MapCache) Exists(key string) bool {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	s := c.shard(c.hash(key))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	_, exists := c.data[key]
+	_, exists := s.items[key]
 
 	return exists
 }
 
-// Close stops the cache cleaner and releases resources.
-func (c *MapCache) Close() error {
-	c.cleaner.Stop()
+// Len returns the number of entries in the cache, including expired entries not removed yet.
+func (c *MapCache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		n += len(s.items)
+		s.mutex.Unlock()
+	}
 
-	close(c.stopCleaner)
+	return n
+}
+
+// Bytes returns the estimated memory of the entries in the cache, see MapCacheOption.Sizer.
+func (c *MapCache) Bytes() int64 {
+	var n int64
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		n += s.bytes
+		s.mutex.Unlock()
+	}
+
+	return n
+}
+
+// Tag associates the tags with the stored key, so it can be deleted with InvalidateTags.
+// The tags of an entry are dropped when it is replaced or removed. It implements Invalidator.
+func (c *MapCache) Tag(key string, tags ...string) error {
+	if !c.Exists(key) {
+		return nil
+	}
+
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+
+		if _, ok := keys[key]; !ok {
+			keys[key] = struct{}{}
+			c.keyTags[key] = append(c.keyTags[key], tag)
+		}
+	}
 
 	return nil
 }
+
+// InvalidateTags deletes the entries associated with any of the tags. It implements Invalidator.
+func (c *MapCache) InvalidateTags(tags ...string) (int, error) {
+	keys := make(map[string]struct{})
+
+	c.tagMutex.Lock()
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			keys[key] = struct{}{}
+		}
+	}
+	c.tagMutex.Unlock()
+
+	return c.invalidate(func(key string) bool {
+		_, ok := keys[key]
+		return ok
+	}), nil
+}
+
+// InvalidatePrefix deletes the entries whose key starts with the prefix. It implements Invalidator.
+func (c *MapCache) InvalidatePrefix(prefix string) (int, error) {
+	return c.invalidate(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}), nil
+}
+
+// InvalidatePattern deletes the entries whose key matches the glob pattern. It implements Invalidator.
+func (c *MapCache) InvalidatePattern(pattern string) (int, error) {
+	return c.invalidate(func(key string) bool {
+		return matchGlob(pattern, key)
+	}), nil
+}
+
+// invalidate deletes the entries whose key matches, returning how many were deleted.
+func (c *MapCache) invalidate(match func(key string) bool) int {
+	n := 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		var evicted []evictedItem
+		for key, it := range s.items {
+			if match(key) {
+				evicted = append(evicted, s.remove(it, EvictedByInvalidate))
+			}
+		}
+		s.mutex.Unlock()
+
+		c.notify(evicted)
+		n += len(evicted)
+	}
+
+	return n
+}
+
+// Close stops the cache cleaner and releases resources. With a SnapshotPath, the cache is saved to it first.
+func (c *MapCache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if c.cleaner != nil {
+			c.cleaner.Stop()
+		}
+
+		close(c.stop)
+		c.running.Wait()
+
+		if c.option.SnapshotPath != "" {
+			err = c.SnapshotFile(c.option.SnapshotPath)
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,216 @@
+package extensions
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	LocaleKey contextKey = "locale" // LocaleKey is the context key used to override the locale of the validation messages.
+)
+
+// Codes of the validation messages that are not validation rules. Validation rules use their name as code, e.g. `required`.
+const (
+	CodeInvalidRequestBody       = "invalid_request_body"
+	CodeInvalidRequestParameters = "invalid_request_parameters"
+	CodeRequestBodyTooLarge      = "request_body_too_large"
+	CodeUnsupportedContentType   = "unsupported_content_type"
+	CodeUnsupportedMediaType     = "unsupported_media_type"
+	CodeInvalidBody              = "invalid_body"
+	CodeInvalidType              = "invalid_type"
+	CodeInvalidValue             = "invalid_value"
+)
+
+// DefaultLocale is the locale used when the request doesn't ask for a supported one.
+var DefaultLocale = "en"
+
+// MessageCatalog provides the message templates of the validation codes.
+// Templates may contain the `{field}` and `{param}` placeholders.
+type MessageCatalog interface {
+	// Message returns the template of the code in the locale.
+	Message(locale, code string) (string, bool)
+	// Locales returns the locales supported by the catalog.
+	Locales() []string
+}
+
+// MapCatalog is a MessageCatalog backed by a map of locale to code to template.
+type MapCatalog map[string]map[string]string
+
+func (c MapCatalog) Message(locale, code string) (string, bool) {
+	message, ok := c[locale][code]
+	return message, ok
+}
+
+func (c MapCatalog) Locales() []string {
+	locales := make([]string, 0, len(c))
+	for locale := range c {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// DefaultMessageCatalog contains the English and Indonesian messages of the built-in codes.
+var DefaultMessageCatalog = MapCatalog{
+	"en": {
+		"required":                   "{field} is required",
+		"email":                      "{field} must be a valid email address",
+		"url":                        "{field} must be a valid URL",
+		"uuid":                       "{field} must be a valid UUID",
+		"alpha":                      "{field} must contain only letters",
+		"alphanum":                   "{field} must contain only letters and numbers",
+		"numeric":                    "{field} must be a number",
+		"min":                        "{field} must be at least {param}",
+		"max":                        "{field} must be at most {param}",
+		"len":                        "{field} must have a length of {param}",
+		"gt":                         "{field} must be greater than {param}",
+		"gte":                        "{field} must be greater than or equal to {param}",
+		"lt":                         "{field} must be less than {param}",
+		"lte":                        "{field} must be less than or equal to {param}",
+		"eq":                         "{field} must be equal to {param}",
+		"ne":                         "{field} must not be equal to {param}",
+		"oneof":                      "{field} must be one of [{param}]",
+		CodeInvalidRequestBody:       "Invalid request body",
+		CodeInvalidRequestParameters: "Invalid request parameters",
+		CodeRequestBodyTooLarge:      "Request body too large",
+		CodeUnsupportedContentType:   "Unsupported content type",
+		CodeUnsupportedMediaType:     "{param} is not supported",
+		CodeInvalidBody:              "{field} is malformed: {param}",
+		CodeInvalidType:              "{field} must be a {param}",
+		CodeInvalidValue:             "{field} has an invalid value {param}",
+	},
+	"id": {
+		"required":                   "{field} wajib diisi",
+		"email":                      "{field} harus berupa alamat email yang valid",
+		"url":                        "{field} harus berupa URL yang valid",
+		"uuid":                       "{field} harus berupa UUID yang valid",
+		"alpha":                      "{field} hanya boleh berisi huruf",
+		"alphanum":                   "{field} hanya boleh berisi huruf dan angka",
+		"numeric":                    "{field} harus berupa angka",
+		"min":                        "{field} minimal {param}",
+		"max":                        "{field} maksimal {param}",
+		"len":                        "{field} harus memiliki panjang {param}",
+		"gt":                         "{field} harus lebih besar dari {param}",
+		"gte":                        "{field} harus lebih besar dari atau sama dengan {param}",
+		"lt":                         "{field} harus lebih kecil dari {param}",
+		"lte":                        "{field} harus lebih kecil dari atau sama dengan {param}",
+		"eq":                         "{field} harus sama dengan {param}",
+		"ne":                         "{field} tidak boleh sama dengan {param}",
+		"oneof":                      "{field} harus salah satu dari [{param}]",
+		CodeInvalidRequestBody:       "Isi permintaan tidak valid",
+		CodeInvalidRequestParameters: "Parameter permintaan tidak valid",
+		CodeRequestBodyTooLarge:      "Isi permintaan terlalu besar",
+		CodeUnsupportedContentType:   "Tipe konten tidak didukung",
+		CodeUnsupportedMediaType:     "{param} tidak didukung",
+		CodeInvalidBody:              "{field} tidak valid: {param}",
+		CodeInvalidType:              "{field} harus bertipe {param}",
+		CodeInvalidValue:             "{field} memiliki nilai tidak valid {param}",
+	},
+}
+
+var (
+	messageCatalog      MessageCatalog = DefaultMessageCatalog
+	messageCatalogMutex sync.RWMutex
+)
+
+// SetMessageCatalog replaces the catalog used for validation messages.
+// Codes missing from the catalog fall back to the DefaultLocale, then to the English messages of DefaultMessageCatalog.
+func SetMessageCatalog(catalog MessageCatalog) {
+	messageCatalogMutex.Lock()
+	defer messageCatalogMutex.Unlock()
+
+	messageCatalog = catalog
+}
+
+func getMessageCatalog() MessageCatalog {
+	messageCatalogMutex.RLock()
+	defer messageCatalogMutex.RUnlock()
+
+	return messageCatalog
+}
+
+// translate returns the message of the code in the locale with the placeholders replaced.
+// fallback is used when neither the catalog nor the default messages know the code.
+func translate(locale, code, fallback, field, param string) string {
+	catalog := getMessageCatalog()
+
+	message, ok := catalog.Message(locale, code)
+	if !ok {
+		message, ok = catalog.Message(DefaultLocale, code)
+	}
+
+	if !ok {
+		message, ok = DefaultMessageCatalog.Message("en", code)
+	}
+
+	if !ok {
+		message = fallback
+	}
+
+	return formatValidationMessage(message, field, param)
+}
+
+// WithLocale returns a shallow copy of r that uses the locale for the validation messages, regardless of `Accept-Language`.
+func WithLocale(r *http.Request, locale string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), LocaleKey, locale))
+}
+
+// RequestLocale returns the locale of the validation messages of the request. The locale set with WithLocale wins,
+// then the best match of the `Accept-Language` header among the catalog locales, then DefaultLocale.
+func RequestLocale(r *http.Request) string {
+	if r == nil {
+		return DefaultLocale
+	}
+
+	if locale, ok := r.Context().Value(LocaleKey).(string); ok && locale != "" {
+		return locale
+	}
+
+	header := r.Header.Get("Accept-Language")
+	if header == "" {
+		return DefaultLocale
+	}
+
+	type language struct {
+		tag string
+		q   float64
+	}
+
+	languages := []language{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		if tag != "" && tag != "*" && q > 0 {
+			languages = append(languages, language{tag: strings.ToLower(tag), q: q})
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+
+	locales := getMessageCatalog().Locales()
+	for _, lang := range languages {
+		base, _, _ := strings.Cut(lang.tag, "-")
+		for _, candidate := range []string{lang.tag, base} {
+			for _, locale := range locales {
+				if strings.EqualFold(locale, candidate) {
+					return locale
+				}
+			}
+		}
+	}
+
+	return DefaultLocale
+}
@@ -2,7 +2,12 @@ package extensions
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -15,25 +20,88 @@ var (
 	ErrorExpirationInFuture   = errors.New("expiration time must be in the future")
 )
 
+// unlockScript deletes a lock only if it still holds the token of its owner, so an expired lock taken over
+// by another instance is not released.
+var unlockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// tagScript adds the key ARGV[1], whose PTTL is ARGV[2], to the tag set KEYS[1], which expires with the last of
+// its keys. Tag sets are updated one at a time, as they may live on other nodes than the key in a cluster.
+var tagScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+local current = redis.call("PTTL", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+if ttl == -1 then
+	redis.call("PERSIST", KEYS[1])
+elseif current == -2 or (current >= 0 and current < ttl) then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1`)
+
+// redisMetaPrefix starts the keys of the tag sets and locks, in front of the prefix of the cache, so they can't
+// collide with the cache keys and aren't matched by the invalidations. Cache keys starting with it are reserved.
+const redisMetaPrefix = "\x00"
+
+// redisScanCount is the number of keys scanned per SCAN call, and deleted per pipeline, when invalidating entries.
+const redisScanCount = 1000
+
+// RedisCacheOption defines the configuration options for RedisCache.
+type RedisCacheOption struct {
+	// TTL is the default time-to-live of the entries stored with Set.
+	TTL time.Duration
+	// Prefix namespaces the keys of the cache, e.g. `myapp:`, so several applications can share a Redis database.
+	// The tag sets and locks are stored apart from the keys, under `"\x00" + Prefix`, so InvalidatePattern
+	// and InvalidatePrefix never delete them.
+	Prefix string
+	// Codec encodes the stored values. if nil, RawCodec is used.
+	Codec Codec
+}
+
+// DefaultRedisCacheOption provides default values for RedisCache, storing `[]byte` and `string` values as is.
+var DefaultRedisCacheOption = RedisCacheOption{
+	TTL:   5 * time.Minute,
+	Codec: RawCodec,
+}
+
+// RedisCache is a Cache stored in Redis. Its commands, including Lock, Tag and the invalidations, run with
+// context.Background, or with the context given to WithContext. The typed cache.Redis takes the context of every call.
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ttl    time.Duration
+	prefix string
+	codec  Codec
 	ctx    context.Context
 }
 
-// NewRedisCache creates a new RedisCache instance with the provided Redis client.
-func NewRedisCache(client *redis.Client) (*RedisCache, error) {
-	if client == nil {
+// NewRedisCache creates a new RedisCache instance with the provided Redis client. The client can be a
+// `*redis.Client`, a `*redis.ClusterClient`, a failover client of Sentinel, or any other redis.UniversalClient.
+func NewRedisCache(client redis.UniversalClient) (*RedisCache, error) {
+	return NewRedisCacheWithOption(client, nil)
+}
+
+// NewRedisCacheWithOption creates a new RedisCache with the options. if option is nil, it uses the default options.
+func NewRedisCacheWithOption(client redis.UniversalClient, option *RedisCacheOption) (*RedisCache, error) {
+	if client == nil || reflect.ValueOf(client).IsNil() {
 		return nil, ErrorRedisClientNil
 	}
 
+	if option == nil {
+		option = &DefaultRedisCacheOption
+	}
+
 	if cmd := client.Ping(context.Background()); cmd.Err() != nil && cmd.Err() != redis.Nil {
 		return nil, cmd.Err()
 	}
 
+	codec := option.Codec
+	if codec == nil {
+		codec = RawCodec
+	}
+
 	return &RedisCache{
 		client: client,
-		ttl:    5 * time.Minute,
+		ttl:    option.TTL,
+		prefix: option.Prefix,
+		codec:  codec,
 		ctx:    context.Background(),
 	}, nil
 }
@@ -43,51 +111,122 @@ func (c *RedisCache) SetDefaultTTL(ttl time.Duration) {
 	c.ttl = ttl
 }
 
+// DefaultTTL returns the default time-to-live of the entries stored with Set.
+func (c *RedisCache) DefaultTTL() time.Duration {
+	return c.ttl
+}
+
+// Client returns the Redis client of the cache.
+func (c *RedisCache) Client() redis.UniversalClient {
+	return c.client
+}
+
+// Codec returns the codec of the stored values.
+func (c *RedisCache) Codec() Codec {
+	return c.codec
+}
+
+// WithContext returns a shallow copy of the cache whose commands run with ctx, so its deadline and cancellation
+// reach Redis, e.g. `cache.WithContext(r.Context()).InvalidateTags("users")`. The copy shares the client of the cache.
+func (c *RedisCache) WithContext(ctx context.Context) *RedisCache {
+	copied := *c
+	copied.ctx = ctx
+
+	return &copied
+}
+
+// Key returns the Redis key of the cache key, with the prefix of the cache.
+func (c *RedisCache) Key(key string) string {
+	return c.prefix + key
+}
+
 // Get retrieves a value from the cache by key.
 func (c *RedisCache) Get(key string) (interface{}, bool) {
-	val, err := c.client.Get(c.ctx, key).Result()
+	value, ok, _ := c.get(key)
+
+	return value, ok
+}
+
+// get retrieves a value from the cache by key, telling a missing key from a failure to reach Redis.
+func (c *RedisCache) get(key string) (interface{}, bool, error) {
+	data, err := c.client.Get(c.ctx, c.Key(key)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	var value interface{}
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// getWithExpiration is like get, but also returns the expiration time of the key in Unix seconds, or 0 if it
+// never expires. The value and the time-to-live are read in a single round trip.
+func (c *RedisCache) getWithExpiration(key string) (interface{}, int64, bool, error) {
+	pipe := c.client.Pipeline()
+	get := pipe.Get(c.ctx, c.Key(key))
+	ttl := pipe.PTTL(c.ctx, c.Key(key))
+	if _, err := pipe.Exec(c.ctx); err != nil && err != redis.Nil {
+		return nil, 0, false, err
+	}
+
+	data, err := get.Bytes()
+	if err == redis.Nil {
+		return nil, 0, false, nil
+	}
+
 	if err != nil {
-		return nil, false
+		return nil, 0, false, err
+	}
+
+	// PTTL replies -2 if the key expired since GET and -1 if it has no expiration, unscaled by go-redis.
+	var expiresAt int64
+	switch d := ttl.Val(); {
+	case d == -2:
+		return nil, 0, false, nil
+	case d > 0:
+		expiresAt = time.Now().Add(d).Unix()
 	}
 
-	return []byte(val), true
+	var value interface{}
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return nil, 0, false, err
+	}
+
+	return value, expiresAt, true, nil
 }
 
 // Set adds a value to the cache with a default expiration time.
-// It supports string and []byte types, returning an error for unsupported types.
+// The value is encoded with the codec of the cache, returning its error for unsupported types.
 func (c *RedisCache) Set(key string, value interface{}) error {
 	if value == nil {
 		return ErrorRedisValueNil
 	}
 
-	var val string
-	switch v := value.(type) {
-	case string:
-		val = v
-	case []byte:
-		val = string(v)
-	default:
-		return ErrorRedisUnsupportedType
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
 	}
 
-	return c.client.Set(c.ctx, key, val, c.ttl).Err()
+	return c.client.Set(c.ctx, c.Key(key), data, c.ttl).Err()
 }
 
 // SetWithExpiration adds a value to the cache with a specific expiration time.
-// It supports string and []byte types, returning an error for unsupported types.
+// The value is encoded with the codec of the cache, returning its error for unsupported types.
 func (c *RedisCache) SetWithExpiration(key string, value interface{}, expiration int64) error {
 	if value == nil {
 		return ErrorRedisValueNil
 	}
 
-	var val string
-	switch v := value.(type) {
-	case string:
-		val = v
-	case []byte:
-		val = string(v)
-	default:
-		return ErrorRedisUnsupportedType
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
 	}
 
 	// Calculate TTL from expiration timestamp
@@ -97,17 +236,17 @@ func (c *RedisCache) SetWithExpiration(key string, value interface{}, expiration
 	}
 
 	ttl := time.Duration(expiration-now) * time.Second
-	return c.client.Set(c.ctx, key, val, ttl).Err()
+	return c.client.Set(c.ctx, c.Key(key), data, ttl).Err()
 }
 
 // Delete removes a value from the cache by key.
 func (c *RedisCache) Delete(key string) error {
-	return c.client.Del(c.ctx, key).Err()
+	return c.client.Del(c.ctx, c.Key(key)).Err()
 }
 
 // Exists checks if a key exists in the cache.
 func (c *RedisCache) Exists(key string) bool {
-	result, err := c.client.Exists(c.ctx, key).Result()
+	result, err := c.client.Exists(c.ctx, c.Key(key)).Result()
 	if err != nil {
 		return false
 	}
@@ -118,3 +257,192 @@ func (c *RedisCache) Exists(key string) bool {
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
+
+// Lock acquires the lock named key for ttl with `SET NX`, so a single instance runs the work it guards.
+// Locks have their own namespace, so a lock can be named after the cache key it guards.
+// It returns false if the lock is held by another owner. It implements Locker.
+func (c *RedisCache) Lock(key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, err
+	}
+
+	value := hex.EncodeToString(token)
+	key = c.lockKey(key)
+
+	ok, err := c.client.SetNX(c.ctx, key, value, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	// The lock is released even if the context of the cache is canceled meanwhile.
+	unlock := func() {
+		unlockScript.Run(context.WithoutCancel(c.ctx), c.client, []string{key}, value)
+	}
+
+	return unlock, true, nil
+}
+
+// tagKey returns the key of the set holding the keys of the tag.
+func (c *RedisCache) tagKey(tag string) string {
+	return redisMetaPrefix + c.prefix + "tag:" + tag
+}
+
+// lockKey returns the key of the lock named name.
+func (c *RedisCache) lockKey(name string) string {
+	return redisMetaPrefix + c.prefix + "lock:" + name
+}
+
+// Tag associates the tags with the stored key, in a set per tag expiring with its last key. It implements Invalidator.
+func (c *RedisCache) Tag(key string, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	key = c.Key(key)
+
+	ttl, err := c.client.PTTL(c.ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	// The client keeps the replies of PTTL for a missing key and a key without expiration, -2 and -1, unscaled.
+	switch ttl {
+	case -2:
+		return nil
+	case -1:
+	default:
+		ttl = ttl / time.Millisecond
+	}
+
+	for _, tag := range tags {
+		if err := tagScript.Run(c.ctx, c.client, []string{c.tagKey(tag)}, key, int64(ttl)).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InvalidateTags deletes the entries associated with any of the tags, and the tags. It implements Invalidator.
+func (c *RedisCache) InvalidateTags(tags ...string) (int, error) {
+	_, n, err := c.invalidateTags(tags...)
+
+	return n, err
+}
+
+// invalidateTags deletes the entries of the tags, and the tags. It returns the cache keys of the tags,
+// without the prefix, including those of the tags invalidated before an error, and the number of deleted entries.
+func (c *RedisCache) invalidateTags(tags ...string) ([]string, int, error) {
+	var members []string
+
+	n := 0
+	for _, tag := range tags {
+		keys, err := c.client.SMembers(c.ctx, c.tagKey(tag)).Result()
+		if err != nil {
+			return members, n, err
+		}
+
+		for _, key := range keys {
+			members = append(members, strings.TrimPrefix(key, c.prefix))
+		}
+
+		deleted, err := c.deleteKeys(keys)
+		n += deleted
+		if err != nil {
+			return members, n, err
+		}
+
+		if err := c.client.Del(c.ctx, c.tagKey(tag)).Err(); err != nil {
+			return members, n, err
+		}
+	}
+
+	return members, n, nil
+}
+
+// InvalidatePrefix deletes the entries whose key starts with the prefix. It implements Invalidator.
+func (c *RedisCache) InvalidatePrefix(prefix string) (int, error) {
+	return c.InvalidatePattern(escapeGlob(prefix) + "*")
+}
+
+// InvalidatePattern deletes the entries whose key matches the pattern, scanning the keys with `SCAN MATCH`,
+// on every master of a cluster. It implements Invalidator.
+func (c *RedisCache) InvalidatePattern(pattern string) (int, error) {
+	pattern = escapeGlob(c.prefix) + pattern
+
+	cluster, ok := c.client.(*redis.ClusterClient)
+	if !ok {
+		return c.invalidatePattern(c.ctx, c.client, pattern)
+	}
+
+	var n atomic.Int64
+	err := cluster.ForEachMaster(c.ctx, func(ctx context.Context, client *redis.Client) error {
+		deleted, err := c.invalidatePattern(ctx, client, pattern)
+		n.Add(int64(deleted))
+
+		return err
+	})
+
+	return int(n.Load()), err
+}
+
+// invalidatePattern deletes the keys matching the pattern on the node of the client.
+func (c *RedisCache) invalidatePattern(ctx context.Context, client redis.UniversalClient, pattern string) (int, error) {
+	n := 0
+	iter := client.Scan(ctx, 0, pattern, redisScanCount).Iterator()
+
+	batch := make([]string, 0, redisScanCount)
+	for iter.Next(ctx) {
+		// Without a prefix, a pattern like `*` also matches the tag sets and locks.
+		if strings.HasPrefix(iter.Val(), redisMetaPrefix) {
+			continue
+		}
+
+		batch = append(batch, iter.Val())
+		if len(batch) < redisScanCount {
+			continue
+		}
+
+		deleted, err := c.deleteKeys(batch)
+		n += deleted
+		if err != nil {
+			return n, err
+		}
+
+		batch = batch[:0]
+	}
+
+	if err := iter.Err(); err != nil {
+		return n, err
+	}
+
+	deleted, err := c.deleteKeys(batch)
+
+	return n + deleted, err
+}
+
+// deleteKeys deletes the keys in pipelines of single key deletions, which a cluster routes to the node of every key,
+// returning the number of deleted keys.
+func (c *RedisCache) deleteKeys(keys []string) (int, error) {
+	n := 0
+	for start := 0; start < len(keys); start += redisScanCount {
+		end := min(start+redisScanCount, len(keys))
+
+		pipe := c.client.Pipeline()
+		for _, key := range keys[start:end] {
+			pipe.Del(c.ctx, key)
+		}
+
+		cmds, err := pipe.Exec(c.ctx)
+		for _, cmd := range cmds {
+			n += int(cmd.(*redis.IntCmd).Val())
+		}
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,34 @@
+package extensions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedisCacheMetaKeys(t *testing.T) {
+	for _, prefix := range []string{"", "app:", "a*b:"} {
+		t.Run(prefix, func(t *testing.T) {
+			c := &RedisCache{prefix: prefix}
+
+			meta := []string{c.tagKey("users"), c.lockKey("GET:/users"), c.tagKey("*"), c.lockKey("")}
+			keys := []string{c.Key("tag:users"), c.Key("lock:GET:/users"), c.Key(prefix + "tag:users"), c.Key("")}
+
+			for _, m := range meta {
+				for _, k := range keys {
+					if m == k {
+						t.Errorf("meta key %q collides with a cache key", m)
+					}
+				}
+
+				// Without a prefix, the SCAN of a pattern like `*` matches them and they are skipped after it.
+				if prefix != "" && matchGlob(escapeGlob(prefix)+"*", m) {
+					t.Errorf("meta key %q is matched by InvalidatePrefix(%q)", m, "")
+				}
+
+				if !strings.HasPrefix(m, redisMetaPrefix) {
+					t.Errorf("meta key %q is outside of the meta namespace", m)
+				}
+			}
+		})
+	}
+}
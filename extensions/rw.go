@@ -13,6 +13,8 @@ type CustomResponseWriter struct {
 	http.ResponseWriter
 	StatusCode int
 	Body       *bytes.Buffer
+	flushed    bool // flushed reports whether the headers were already sent by Flush.
+	sent       int  // sent is the length of Body already written to the underlying writer.
 }
 
 func NewCustomResponseWriter(w http.ResponseWriter) *CustomResponseWriter {
@@ -31,14 +33,37 @@ func (rw *CustomResponseWriter) Write(b []byte) (int, error) {
 	return rw.Body.Write(b)
 }
 
+// Flush writes the status code and the buffered body to the underlying writer. Body keeps the written data.
+// It can be called several times, each call only writes the data written since the previous one.
 func (rw *CustomResponseWriter) Flush() {
-	rw.ResponseWriter.WriteHeader(rw.StatusCode)
+	if !rw.flushed {
+		rw.ResponseWriter.WriteHeader(rw.StatusCode)
+		rw.flushed = true
+	}
 
-	if rw.Body.Len() > 0 {
-		rw.ResponseWriter.Write(rw.Body.Bytes())
+	if rw.Body.Len() > rw.sent {
+		rw.ResponseWriter.Write(rw.Body.Bytes()[rw.sent:])
+		rw.sent = rw.Body.Len()
 	}
 }
 
+// FlushError writes the buffered response like Flush, then flushes the underlying writer to the client.
+// It is used by http.ResponseController, so streamed responses pass through the middlewares that buffer the response.
+// The streamed data is dropped from Body so a long stream doesn't grow the buffer, see Flushed.
+func (rw *CustomResponseWriter) FlushError() error {
+	rw.Flush()
+	rw.Body.Reset()
+	rw.sent = 0
+
+	return http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Flushed reports whether the response was already sent to the client, e.g. because the handler streamed it.
+// Middlewares that inspect the buffered response must skip flushed responses, as Body may only hold their tail.
+func (rw *CustomResponseWriter) Flushed() bool {
+	return rw.flushed
+}
+
 func (rw *CustomResponseWriter) Header() http.Header {
 	if rw.ResponseWriter == nil {
 		return http.Header{}
@@ -0,0 +1,59 @@
+package extensions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCustomResponseWriterFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := NewCustomResponseWriter(w)
+
+	rw.WriteHeader(http.StatusAccepted)
+	rw.Write([]byte("first "))
+	if rw.Flushed() || w.Body.Len() > 0 {
+		t.Fatal("the response was sent before Flush")
+	}
+
+	rw.Flush()
+	rw.Write([]byte("second"))
+	rw.Flush()
+	rw.Flush()
+
+	if w.Code != http.StatusAccepted || w.Body.String() != "first second" {
+		t.Errorf("response = %d %q, want 202 %q", w.Code, w.Body.String(), "first second")
+	}
+
+	if rw.Body.String() != "first second" {
+		t.Errorf("Body after Flush = %q, want the whole body", rw.Body.String())
+	}
+
+	if !rw.Flushed() {
+		t.Error("Flushed = false after Flush")
+	}
+}
+
+func TestCustomResponseWriterStream(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := NewCustomResponseWriter(w)
+	rc := http.NewResponseController(rw)
+
+	for _, chunk := range []string{"a", "b", "c"} {
+		rw.Write([]byte(chunk))
+		if err := rc.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+
+		if rw.Body.Len() > 0 {
+			t.Errorf("Body = %q after streaming, want the streamed data dropped", rw.Body.String())
+		}
+	}
+
+	rw.Write([]byte("d"))
+	rw.Flush()
+
+	if !w.Flushed || w.Body.String() != "abcd" || !rw.Flushed() {
+		t.Errorf("response = %q, flushed %v, want %q streamed", w.Body.String(), w.Flushed, "abcd")
+	}
+}
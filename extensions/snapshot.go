@@ -0,0 +1,263 @@
+package extensions
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrorSnapshotInvalid = errors.New("invalid cache snapshot")
+	ErrorSnapshotVersion = errors.New("unsupported cache snapshot version")
+)
+
+// A snapshot starts with snapshotMagic and its version, followed by the entries, each a snapshotEntry byte,
+// the key length and key, the expiration time and the value length and value, in varints. The entries end with
+// a snapshotEnd byte and the CRC-32 of everything before it.
+const (
+	snapshotMagic   = "MHKS"
+	snapshotVersion = 1
+
+	snapshotEnd   byte = 0
+	snapshotEntry byte = 1
+)
+
+func (c *MapCache) snapshotCodec() Codec {
+	if c.option.SnapshotCodec != nil {
+		return c.option.SnapshotCodec
+	}
+
+	return GobCodec
+}
+
+// Snapshot writes the entries of the cache to w, with their expiration time, so they can be loaded with Restore,
+// e.g. by the next process after a deploy. Values are encoded with the SnapshotCodec, and the values it cannot
+// encode are left out. Each shard is locked while its entries are copied, not while they are written.
+func (c *MapCache) Snapshot(w io.Writer) error {
+	codec := c.snapshotCodec()
+	hash := crc32.NewIEEE()
+	writer := bufio.NewWriter(io.MultiWriter(w, hash))
+
+	if _, err := writer.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+
+	writer.WriteByte(snapshotVersion)
+
+	now := time.Now().Unix()
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		entries := make(map[string]CacheEntry, len(s.items))
+		for key, it := range s.items {
+			if it.entry.ExpiresAt <= 0 || now <= it.entry.ExpiresAt {
+				entries[key] = it.entry
+			}
+		}
+		s.mutex.Unlock()
+
+		for key, entry := range entries {
+			value, err := codec.Marshal(entry.Value)
+			if err != nil {
+				continue
+			}
+
+			writer.WriteByte(snapshotEntry)
+			writer.Write(buf[:binary.PutUvarint(buf, uint64(len(key)))])
+			writer.WriteString(key)
+			writer.Write(buf[:binary.PutVarint(buf, entry.ExpiresAt)])
+			writer.Write(buf[:binary.PutUvarint(buf, uint64(len(value)))])
+			if _, err := writer.Write(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.WriteByte(snapshotEnd)
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(binary.LittleEndian.AppendUint32(nil, hash.Sum32()))
+
+	return err
+}
+
+// Restore loads the entries of a snapshot written by Snapshot into the cache, keeping their expiration time
+// and skipping the expired ones. Nothing is loaded if the snapshot is incomplete or corrupted.
+// Entries are stored like with SetWithExpiration, so the limits of the cache apply.
+func (c *MapCache) Restore(r io.Reader) error {
+	codec := c.snapshotCodec()
+	buffered := bufio.NewReader(r)
+	reader := &snapshotReader{reader: buffered, hash: crc32.NewIEEE()}
+
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrorSnapshotInvalid
+	}
+
+	if header[len(snapshotMagic)] != snapshotVersion {
+		return ErrorSnapshotVersion
+	}
+
+	var keys []string
+	var entries []CacheEntry
+	for {
+		kind, err := reader.ReadByte()
+		if err != nil || (kind != snapshotEntry && kind != snapshotEnd) {
+			return ErrorSnapshotInvalid
+		}
+
+		if kind == snapshotEnd {
+			break
+		}
+
+		key, err := reader.readBytes()
+		if err != nil {
+			return ErrorSnapshotInvalid
+		}
+
+		expiresAt, err := binary.ReadVarint(reader)
+		if err != nil {
+			return ErrorSnapshotInvalid
+		}
+
+		data, err := reader.readBytes()
+		if err != nil {
+			return ErrorSnapshotInvalid
+		}
+
+		var value interface{}
+		if err := codec.Unmarshal(data, &value); err != nil {
+			return errors.Join(ErrorSnapshotInvalid, err)
+		}
+
+		keys = append(keys, string(key))
+		entries = append(entries, CacheEntry{Value: value, ExpiresAt: expiresAt})
+	}
+
+	checksum := make([]byte, 4)
+	if _, err := io.ReadFull(buffered, checksum); err != nil || binary.LittleEndian.Uint32(checksum) != reader.hash.Sum32() {
+		return ErrorSnapshotInvalid
+	}
+
+	now := time.Now().Unix()
+	for i, entry := range entries {
+		if entry.ExpiresAt > 0 && now > entry.ExpiresAt {
+			continue
+		}
+
+		if err := c.SetWithExpiration(keys[i], entry.Value, entry.ExpiresAt); err != nil && !errors.Is(err, ErrorMapEntryTooLarge) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshotReader reads a snapshot, computing the checksum of the bytes read.
+type snapshotReader struct {
+	reader *bufio.Reader
+	hash   hash.Hash32
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+
+	return n, err
+}
+
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.hash.Write([]byte{b})
+	}
+
+	return b, err
+}
+
+// readBytes reads a length prefixed byte string.
+func (r *snapshotReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bytes are read in chunks, so a corrupted length doesn't allocate more than the snapshot holds.
+	var data []byte
+	for remaining := n; remaining > 0; {
+		chunk := make([]byte, min(remaining, 64*1024))
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+
+		data = append(data, chunk...)
+		remaining -= uint64(len(chunk))
+	}
+
+	return data, nil
+}
+
+// SnapshotFile saves the cache to the file with Snapshot. The snapshot is written to a temporary file first,
+// so the file always holds a complete snapshot.
+func (c *MapCache) SnapshotFile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := c.Snapshot(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	if err := errors.Join(file.Sync(), file.Close()); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return nil
+}
+
+// RestoreFile loads the snapshot saved in the file with Restore.
+func (c *MapCache) RestoreFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.Restore(file)
+}
+
+func (c *MapCache) startSnapshots() {
+	defer c.running.Done()
+
+	ticker := time.NewTicker(c.option.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.SnapshotFile(c.option.SnapshotPath); err != nil {
+				log.Printf("cache: saving snapshot %s: %v", c.option.SnapshotPath, err)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package extensions
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSnapshotCache() *MapCache {
+	return NewMapCacheWithOption(&MapCacheOption{TTL: time.Minute, Shards: 4, Policy: EvictionLRU})
+}
+
+func TestMapCacheSnapshotRoundTrip(t *testing.T) {
+	source := newTestSnapshotCache()
+	defer source.Close()
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	values := map[string]interface{}{
+		"string": "value",
+		"bytes":  []byte("raw"),
+		"int":    42,
+		"float":  1.5,
+		"bool":   true,
+		"empty":  "",
+	}
+
+	for key, value := range values {
+		if err := source.SetWithExpiration(key, value, expiresAt); err != nil {
+			t.Fatalf("SetWithExpiration(%q): %v", key, err)
+		}
+	}
+	source.SetWithExpiration("forever", "always", 0)
+	source.SetWithExpiration("expired", "stale", time.Now().Add(-time.Hour).Unix())
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	restored := newTestSnapshotCache()
+	defer restored.Close()
+
+	if err := restored.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	for key, want := range values {
+		entry, ok := restored.GetEntry(key)
+		if !ok {
+			t.Errorf("GetEntry(%q) missed after Restore", key)
+			continue
+		}
+
+		if !reflect.DeepEqual(entry.Value, want) {
+			t.Errorf("GetEntry(%q).Value = %#v, want %#v", key, entry.Value, want)
+		}
+
+		if entry.ExpiresAt != expiresAt {
+			t.Errorf("GetEntry(%q).ExpiresAt = %d, want %d", key, entry.ExpiresAt, expiresAt)
+		}
+	}
+
+	if entry, ok := restored.GetEntry("forever"); !ok || entry.ExpiresAt != 0 {
+		t.Errorf("GetEntry(forever) = %+v, %v, want an entry without expiration", entry, ok)
+	}
+
+	if restored.Exists("expired") {
+		t.Error("expired entry was restored")
+	}
+}
+
+func TestMapCacheSnapshotSkipsUnencodableValues(t *testing.T) {
+	source := newTestSnapshotCache()
+	defer source.Close()
+
+	source.Set("kept", "value")
+	source.Set("func", func() {})
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	restored := newTestSnapshotCache()
+	defer restored.Close()
+
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if !restored.Exists("kept") || restored.Exists("func") {
+		t.Errorf("Exists(kept) = %v, Exists(func) = %v, want true, false", restored.Exists("kept"), restored.Exists("func"))
+	}
+}
+
+func TestMapCacheRestoreCorrupted(t *testing.T) {
+	source := newTestSnapshotCache()
+	defer source.Close()
+
+	source.Set("a", "first value")
+	source.Set("b", "second value")
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	snapshot := buf.Bytes()
+
+	flip := func(i int) []byte {
+		data := bytes.Clone(snapshot)
+		data[i] ^= 0xff
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrorSnapshotInvalid},
+		{"magic", flip(0), ErrorSnapshotInvalid},
+		{"version", flip(len(snapshotMagic)), ErrorSnapshotVersion},
+		{"entry kind", flip(len(snapshotMagic) + 1), ErrorSnapshotInvalid},
+		{"value byte", flip(len(snapshot) - 10), ErrorSnapshotInvalid},
+		{"checksum", flip(len(snapshot) - 1), ErrorSnapshotInvalid},
+		{"missing checksum", snapshot[:len(snapshot)-4], ErrorSnapshotInvalid},
+		{"truncated", snapshot[:len(snapshot)/2], ErrorSnapshotInvalid},
+		{"huge length", append(append([]byte(snapshotMagic), snapshotVersion, snapshotEntry), 0xff, 0xff, 0xff, 0xff, 0x0f), ErrorSnapshotInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := newTestSnapshotCache()
+			defer restored.Close()
+
+			if err := restored.Restore(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+				t.Fatalf("Restore error = %v, want %v", err, tt.want)
+			}
+
+			if restored.Exists("a") || restored.Exists("b") {
+				t.Error("entries were loaded from a corrupted snapshot")
+			}
+		})
+	}
+}
+
+func TestMapCacheSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	source := newTestSnapshotCache()
+	source.Set("key", "value")
+	if err := source.SnapshotFile(path); err != nil {
+		t.Fatalf("SnapshotFile: %v", err)
+	}
+	source.Close()
+
+	matches, _ := filepath.Glob(path + ".*.tmp")
+	if len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	restored := newTestSnapshotCache()
+	defer restored.Close()
+
+	if err := restored.RestoreFile(path); err != nil {
+		t.Fatalf("RestoreFile: %v", err)
+	}
+
+	if value, ok := restored.Get("key"); !ok || value != "value" {
+		t.Errorf("Get(key) = %v, %v, want value", value, ok)
+	}
+
+	if err := restored.RestoreFile(path + ".missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RestoreFile of a missing file error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestMapCacheSnapshotPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	option := &MapCacheOption{TTL: time.Minute, Shards: 4, Policy: EvictionLRU, SnapshotPath: path}
+
+	source := NewMapCacheWithOption(option)
+	source.Set("key", "value")
+	source.Close()
+
+	restored := NewMapCacheWithOption(option)
+	defer restored.Close()
+
+	if value, ok := restored.Get("key"); !ok || value != "value" {
+		t.Errorf("Get(key) = %v, %v, want the value saved by Close", value, ok)
+	}
+}
@@ -0,0 +1,185 @@
+package extensions
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// lockPollInterval is how often an instance waiting for the lock of a key checks whether the response was stored.
+const lockPollInterval = 50 * time.Millisecond
+
+// Locker is implemented by caches shared between instances, like RedisCache, so a single instance runs the handler
+// for a missing key. See ResponseCache.
+type Locker interface {
+	// Lock acquires the lock named key for ttl. It returns false if the lock is held by someone else.
+	// Locks are named after the cache keys they guard, so they must be stored apart from the cache entries.
+	// unlock releases the lock if it is still held by the caller.
+	Lock(key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+// flightGroup tracks the keys being filled, so concurrent requests for a key wait for a single handler call.
+type flightGroup struct {
+	mutex   sync.Mutex
+	flights map[string]chan struct{}
+}
+
+// join returns the channel closed when the key is filled, and whether the caller leads the flight and must finish it.
+func (g *flightGroup) join(key string) (chan struct{}, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if done, ok := g.flights[key]; ok {
+		return done, false
+	}
+
+	if g.flights == nil {
+		g.flights = make(map[string]chan struct{})
+	}
+
+	done := make(chan struct{})
+	g.flights[key] = done
+
+	return done, true
+}
+
+// finish ends the flight of the key, releasing the requests waiting for it.
+func (g *flightGroup) finish(key string, done chan struct{}) {
+	g.mutex.Lock()
+	if g.flights[key] == done {
+		delete(g.flights, key)
+	}
+	g.mutex.Unlock()
+
+	close(done)
+}
+
+// fill runs the handler for a cache miss. Concurrent misses of the key wait for the first one and are served
+// from the response it stored, and with a Locker, instances wait for the one holding the lock of the key.
+func (c *ResponseCache) fill(w http.ResponseWriter, r *http.Request, key string, cc cacheControl, stale *cachedResponse, next http.HandlerFunc) {
+	done, leader := c.flights.join(key)
+	if !leader {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+			return
+		}
+
+		// The response may not be cacheable, or be another variant, then the handler runs for this request too.
+		if entry, fresh, ok := c.lookup(key, r, cc, time.Now()); ok && fresh {
+			c.serve(w, r, entry, time.Now())
+			return
+		}
+
+		c.run(w, r, key, stale, next)
+		return
+	}
+	defer c.flights.finish(key, done)
+
+	if locker, ok := c.cache.(Locker); ok && c.LockTimeout > 0 {
+		unlock, acquired, err := locker.Lock(key, c.LockTimeout)
+		switch {
+		case err != nil:
+			// Without the lock, running the handler is better than failing the request.
+		case acquired:
+			defer unlock()
+		default:
+			if entry, ok := c.await(key, r, cc); ok {
+				c.serve(w, r, entry, time.Now())
+				return
+			}
+		}
+	}
+
+	c.run(w, r, key, stale, next)
+}
+
+// await waits up to LockTimeout for another instance to store a fresh response for the request.
+func (c *ResponseCache) await(key string, r *http.Request, cc cacheControl) (cachedResponse, bool) {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(c.LockTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if entry, fresh, ok := c.lookup(key, r, cc, time.Now()); ok && fresh {
+				return entry, true
+			}
+		case <-timeout.C:
+			return cachedResponse{}, false
+		case <-r.Context().Done():
+			return cachedResponse{}, false
+		}
+	}
+}
+
+// revalidate refreshes the stale response of the key in the background, unless it is already being refreshed.
+// A failing refresh keeps the stale response.
+func (c *ResponseCache) revalidate(key string, r *http.Request, next http.HandlerFunc) {
+	done, leader := c.flights.join(key)
+	if !leader {
+		return
+	}
+
+	req, _ := unconditionalRequest(r.Clone(context.WithoutCancel(r.Context())))
+
+	go func() {
+		defer c.flights.finish(key, done)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("cache: revalidating %s: %v", key, recovered)
+			}
+		}()
+
+		if locker, ok := c.cache.(Locker); ok && c.LockTimeout > 0 {
+			unlock, acquired, err := locker.Lock(key, c.LockTimeout)
+			if err == nil && !acquired {
+				return
+			}
+
+			if acquired {
+				defer unlock()
+			}
+		}
+
+		now := time.Now()
+		rec := &cacheRecorder{header: make(http.Header), status: http.StatusOK}
+		next(rec, req)
+
+		if rec.status < http.StatusInternalServerError {
+			c.store(key, req, rec.status, rec.header, rec.body.Bytes(), now)
+		}
+	}()
+}
+
+// cacheRecorder records the response of a background revalidation, which has no client to reply to.
+type cacheRecorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *cacheRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	if rec.wroteHeader {
+		return
+	}
+
+	rec.wroteHeader = true
+	rec.status = code
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.body.Write(b)
+}
@@ -0,0 +1,228 @@
+package extensions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// expire makes the response stored under the key expired by a second.
+func expire(t *testing.T, c *ResponseCache, key string) {
+	t.Helper()
+
+	entry, ok := c.get(key)
+	if !ok {
+		t.Fatalf("no response stored under %q", key)
+	}
+
+	entry.ExpiresAt = time.Now().Add(-time.Second).UnixNano()
+	if !c.set(key, entry, time.Now().Add(time.Minute)) {
+		t.Fatalf("storing the expired response of %q", key)
+	}
+}
+
+func TestResponseCacheCoalescing(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	c := NewCacheMiddleware(NewMapCache(), nil)
+	handler := c.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("filled"))
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			bodies[i] = w.Body.String()
+		}()
+
+		if i == 0 {
+			<-started
+		}
+	}
+
+	// Let the other requests join the flight of the first one.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", calls.Load())
+	}
+
+	for i, body := range bodies {
+		if body != "filled" {
+			t.Errorf("request %d body = %q, want the response of the first request", i, body)
+		}
+	}
+}
+
+// testLocker is a cache shared with another instance that holds every lock.
+type testLocker struct {
+	*MapCache
+	locks atomic.Int32
+}
+
+func (l *testLocker) Lock(key string, ttl time.Duration) (func(), bool, error) {
+	l.locks.Add(1)
+	return nil, false, nil
+}
+
+func TestResponseCacheLocker(t *testing.T) {
+	locker := &testLocker{MapCache: NewMapCache()}
+	c := NewCacheMiddleware(locker, &CacheOption{LockTimeout: time.Second})
+
+	called := false
+	handler := c.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	// The other instance stores its response while this one waits for the lock.
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		c.store(DefaultCacheKey(httptest.NewRequest(http.MethodGet, "/", nil)), httptest.NewRequest(http.MethodGet, "/", nil),
+			http.StatusOK, http.Header{"Cache-Control": {"max-age=60"}}, []byte("other instance"), time.Now())
+	}()
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if called || w.Body.String() != "other instance" || locker.locks.Load() != 1 {
+		t.Errorf("body = %q, handler called = %v, locks = %d, want the response of the lock holder", w.Body.String(), called, locker.locks.Load())
+	}
+
+	// Without a response before LockTimeout, the handler runs anyway.
+	c.LockTimeout = lockPollInterval
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if !called {
+		t.Error("handler not called after the lock timeout")
+	}
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	refreshed := make(chan struct{}, 1)
+
+	c := NewCacheMiddleware(NewMapCache(), nil)
+	handler := c.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=60")
+		if version.Add(1) == 2 {
+			defer func() { refreshed <- struct{}{} }()
+		}
+		w.Write([]byte{'v', byte('0' + version.Load())})
+	})
+
+	serve := func(cacheControl string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cacheControl != "" {
+			r.Header.Set("Cache-Control", cacheControl)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		return w.Body.String()
+	}
+
+	serve("")
+	expire(t, c, "GET:/")
+
+	if body := serve(""); body != "v1" {
+		t.Fatalf("stale body = %q, want v1 while revalidating", body)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the stale response was not revalidated")
+	}
+
+	// Wait for the background request to store its response and end its flight.
+	deadline := time.Now().Add(time.Second)
+	for body := serve(""); body != "v2"; body = serve("") {
+		if time.Now().After(deadline) {
+			t.Fatalf("body = %q after revalidation, want v2", body)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A client asking for a fresh response waits for the handler.
+	expire(t, c, "GET:/")
+	if body := serve("max-age=0"); body != "v3" {
+		t.Errorf("body with max-age=0 = %q, want v3", body)
+	}
+}
+
+func TestResponseCacheStaleIfError(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		fail         func(w http.ResponseWriter)
+		wantCode     int
+		wantBody     string
+	}{
+		{"server error", "max-age=60, stale-if-error=60", func(w http.ResponseWriter) {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}, http.StatusOK, "v1"},
+		{"panic", "max-age=60, stale-if-error=60", func(w http.ResponseWriter) {
+			panic("down")
+		}, http.StatusOK, "v1"},
+		{"client error", "max-age=60, stale-if-error=60", func(w http.ResponseWriter) {
+			http.Error(w, "gone", http.StatusNotFound)
+		}, http.StatusNotFound, "gone\n"},
+		{"without stale-if-error", "max-age=60", func(w http.ResponseWriter) {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}, http.StatusServiceUnavailable, "down\n"},
+		{"must-revalidate", "max-age=60, stale-if-error=60, must-revalidate", func(w http.ResponseWriter) {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}, http.StatusServiceUnavailable, "down\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := false
+			c := NewCacheMiddleware(NewMapCache(), nil)
+			handler := c.Middleware(func(w http.ResponseWriter, r *http.Request) {
+				if failing {
+					tt.fail(w)
+					return
+				}
+
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				w.Write([]byte("v1"))
+			})
+
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			expire(t, c, "GET:/")
+			failing = true
+
+			w := httptest.NewRecorder()
+			func() {
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						w.WriteHeader(http.StatusInternalServerError)
+					}
+				}()
+				handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			}()
+
+			if w.Code != tt.wantCode || w.Body.String() != tt.wantBody {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package extensions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrorTieredCacheNil      = errors.New("tiered cache tiers cannot be nil")
+	ErrorTieredCacheDegraded = errors.New("tiered cache L2 is unreachable")
+)
+
+// Operations of the invalidation messages broadcast by TieredCache.
+const (
+	tieredDelete  = "delete"
+	tieredTags    = "tags"
+	tieredPrefix  = "prefix"
+	tieredPattern = "pattern"
+)
+
+// TieredCacheOption defines the configuration options for TieredCache.
+type TieredCacheOption struct {
+	// L1TTL is the maximum time an entry is kept in L1, bounding how stale a replica can be if an invalidation
+	// message is lost.
+	L1TTL time.Duration
+	// Channel is the Redis pub/sub channel of the invalidation messages, shared by every replica.
+	Channel string
+	// RetryInterval is how often Redis is pinged while it is unreachable.
+	RetryInterval time.Duration
+	// OnError is called when Redis is unreachable, on connection and timeout errors. The cache then serves L1 alone
+	// until Redis is reachable again. The other errors of Redis and of the codec are returned to the caller.
+	OnError func(error)
+}
+
+// DefaultTieredCacheOption provides default values for TieredCache.
+var DefaultTieredCacheOption = TieredCacheOption{
+	L1TTL:         time.Minute,
+	Channel:       "mahakam:cache:invalidate",
+	RetryInterval: 5 * time.Second,
+	OnError: func(err error) {
+		log.Println(err)
+	},
+}
+
+// TieredCacheStats counts the reads of a TieredCache per tier.
+type TieredCacheStats struct {
+	L1Hits   uint64
+	L2Hits   uint64
+	Misses   uint64
+	L2Errors uint64
+	// Degraded reports whether Redis is unreachable and only L1 is used.
+	Degraded bool
+}
+
+// tieredMessage is an invalidation broadcast to the other replicas.
+type tieredMessage struct {
+	Origin string   `json:"origin"`
+	Op     string   `json:"op"`
+	Keys   []string `json:"keys"`
+}
+
+// TieredCache is a Cache with a small in-process MapCache (L1) in front of a RedisCache (L2) shared by the replicas.
+// Reads are served from L1, then from L2, which fills L1. Writes and invalidations go to both tiers and are
+// broadcast through Redis pub/sub, so the other replicas drop their L1 copy.
+//
+// When Redis is unreachable, the cache serves L1 alone and pings Redis every RetryInterval. L1 is cleared once
+// Redis is back, as invalidations of the other replicas may have been missed. TieredCache is a prometheus.Collector
+// exporting the hits per tier, see Metrics.Add.
+type TieredCache struct {
+	*TieredCacheOption
+	l1       *MapCache
+	l2       *RedisCache
+	id       string
+	pubsub   *redis.PubSub
+	degraded atomic.Bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	l1Hits   atomic.Uint64
+	l2Hits   atomic.Uint64
+	misses   atomic.Uint64
+	l2Errors atomic.Uint64
+}
+
+var (
+	tieredHitsDesc     = prometheus.NewDesc("mahakam_tiered_cache_hits_total", "Number of cache reads served by each tier", []string{"tier"}, nil)
+	tieredMissesDesc   = prometheus.NewDesc("mahakam_tiered_cache_misses_total", "Number of cache reads missing in every tier", nil, nil)
+	tieredErrorsDesc   = prometheus.NewDesc("mahakam_tiered_cache_l2_errors_total", "Number of requests to the L2 cache that failed to reach Redis", nil, nil)
+	tieredDegradedDesc = prometheus.NewDesc("mahakam_tiered_cache_l2_degraded", "Whether the L2 cache is unreachable and only L1 is used", nil, nil)
+)
+
+// NewTieredCache creates a new TieredCache and subscribes to its invalidation channel. if option is nil,
+// it uses the default options. Redis does not need to be reachable yet.
+func NewTieredCache(l1 *MapCache, l2 *RedisCache, option *TieredCacheOption) (*TieredCache, error) {
+	if l1 == nil || l2 == nil {
+		return nil, ErrorTieredCacheNil
+	}
+
+	if option == nil {
+		option = &DefaultTieredCacheOption
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &TieredCache{
+		TieredCacheOption: option,
+		l1:                l1,
+		l2:                l2,
+		id:                hex.EncodeToString(id),
+		stop:              make(chan struct{}),
+	}
+
+	// The subscription reconnects by itself, so an unreachable Redis only starts the cache with L1 alone.
+	c.pubsub = l2.client.Subscribe(context.Background(), option.Channel)
+	if _, err := c.pubsub.Receive(context.Background()); err != nil {
+		c.fail(err)
+	}
+
+	go c.listen()
+
+	return c, nil
+}
+
+// listen applies the invalidations broadcast by the other replicas to L1.
+func (c *TieredCache) listen() {
+	for msg := range c.pubsub.Channel() {
+		var message tieredMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil || message.Origin == c.id {
+			continue
+		}
+
+		c.apply(message)
+	}
+}
+
+// apply applies an invalidation of another replica to L1.
+func (c *TieredCache) apply(message tieredMessage) {
+	switch message.Op {
+	case tieredDelete:
+		for _, key := range message.Keys {
+			c.l1.Delete(key)
+		}
+	case tieredTags:
+		c.l1.InvalidateTags(message.Keys...)
+	case tieredPrefix:
+		for _, prefix := range message.Keys {
+			c.l1.InvalidatePrefix(prefix)
+		}
+	case tieredPattern:
+		for _, pattern := range message.Keys {
+			c.l1.InvalidatePattern(pattern)
+		}
+	}
+}
+
+// publish broadcasts the invalidation to the other replicas.
+func (c *TieredCache) publish(op string, keys ...string) {
+	if c.degraded.Load() {
+		return
+	}
+
+	payload, err := json.Marshal(tieredMessage{Origin: c.id, Op: op, Keys: keys})
+	if err != nil {
+		return
+	}
+
+	c.fail(c.l2.client.Publish(c.l2.ctx, c.Channel, payload).Err())
+}
+
+// fail switches to L1 alone if err tells Redis is unreachable, until Redis answers a ping again. Other errors,
+// like the errors of the codec, are left to the caller. It returns err.
+func (c *TieredCache) fail(err error) error {
+	if !unreachable(err) {
+		return err
+	}
+
+	c.l2Errors.Add(1)
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+
+	if c.degraded.CompareAndSwap(false, true) {
+		go c.recover()
+	}
+
+	return err
+}
+
+// unreachable reports whether err is a connection or timeout error, rather than an error of the command.
+func unreachable(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrClosed) || errors.Is(err, redis.ErrPoolTimeout) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// recover pings Redis until it answers, then clears L1 and uses L2 again.
+func (c *TieredCache) recover() {
+	ticker := time.NewTicker(c.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.l2.client.Ping(c.l2.ctx).Err(); err != nil {
+				continue
+			}
+
+			c.l1.invalidate(func(string) bool {
+				return true
+			})
+
+			c.degraded.Store(false)
+			return
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// l1Expiration returns the expiration of an L1 entry, at most L1TTL from now.
+func (c *TieredCache) l1Expiration(expiration int64) int64 {
+	limit := time.Now().Add(c.L1TTL).Unix()
+	if expiration <= 0 || expiration > limit {
+		return limit
+	}
+
+	return expiration
+}
+
+// Get retrieves a value from L1, or from L2 which then fills L1 until the L2 entry expires, at most for L1TTL.
+func (c *TieredCache) Get(key string) (interface{}, bool) {
+	if value, ok := c.l1.Get(key); ok {
+		c.l1Hits.Add(1)
+		return value, true
+	}
+
+	if !c.degraded.Load() {
+		value, expiresAt, ok, err := c.l2.getWithExpiration(key)
+		if c.fail(err) == nil && ok {
+			c.l2Hits.Add(1)
+			c.l1.SetWithExpiration(key, value, c.l1Expiration(expiresAt))
+			return value, true
+		}
+	}
+
+	c.misses.Add(1)
+
+	return nil, false
+}
+
+// Set stores a value in both tiers with the default expiration time of L2.
+func (c *TieredCache) Set(key string, value interface{}) error {
+	if !c.degraded.Load() {
+		if err := c.fail(c.l2.Set(key, value)); err != nil && !unreachable(err) {
+			return err
+		}
+	}
+
+	c.publish(tieredDelete, key)
+
+	return c.l1.SetWithExpiration(key, value, c.l1Expiration(0))
+}
+
+// SetWithExpiration stores a value in both tiers with a specific expiration time.
+func (c *TieredCache) SetWithExpiration(key string, value interface{}, expiration int64) error {
+	if !c.degraded.Load() {
+		if err := c.fail(c.l2.SetWithExpiration(key, value, expiration)); err != nil && !unreachable(err) {
+			return err
+		}
+	}
+
+	c.publish(tieredDelete, key)
+
+	return c.l1.SetWithExpiration(key, value, c.l1Expiration(expiration))
+}
+
+// Delete removes a value from both tiers and from the L1 of the other replicas.
+func (c *TieredCache) Delete(key string) error {
+	c.l1.Delete(key)
+
+	if c.degraded.Load() {
+		return nil
+	}
+
+	if err := c.fail(c.l2.Delete(key)); err != nil {
+		return err
+	}
+
+	c.publish(tieredDelete, key)
+
+	return nil
+}
+
+// Exists checks if a key exists in either tier.
+func (c *TieredCache) Exists(key string) bool {
+	return c.l1.Exists(key) || (!c.degraded.Load() && c.l2.Exists(key))
+}
+
+// Tag associates the tags with the key in both tiers. It implements Invalidator.
+func (c *TieredCache) Tag(key string, tags ...string) error {
+	c.l1.Tag(key, tags...)
+
+	if c.degraded.Load() {
+		return nil
+	}
+
+	return c.fail(c.l2.Tag(key, tags...))
+}
+
+// InvalidateTags deletes the entries of the tags in both tiers and in the L1 of the other replicas.
+// It returns the number of entries deleted from L2, or from L1 while Redis is unreachable. It implements Invalidator.
+//
+// Entries filled into L1 from L2 are not tagged in L1, so the keys of the tags are resolved in L2 before it is
+// invalidated, then deleted from L1 and broadcast as deleted keys.
+func (c *TieredCache) InvalidateTags(tags ...string) (int, error) {
+	n, _ := c.l1.InvalidateTags(tags...)
+
+	if c.degraded.Load() {
+		return n, nil
+	}
+
+	keys, deleted, err := c.l2.invalidateTags(tags...)
+	err = c.fail(err)
+
+	for _, key := range keys {
+		c.l1.Delete(key)
+	}
+
+	if len(keys) > 0 {
+		c.publish(tieredDelete, keys...)
+	}
+
+	if err != nil {
+		return n, err
+	}
+
+	c.publish(tieredTags, tags...)
+
+	return deleted, nil
+}
+
+// InvalidatePrefix deletes the entries whose key starts with the prefix in every tier. It implements Invalidator.
+func (c *TieredCache) InvalidatePrefix(prefix string) (int, error) {
+	n, _ := c.l1.InvalidatePrefix(prefix)
+
+	return c.invalidate(n, tieredPrefix, []string{prefix}, func() (int, error) {
+		return c.l2.InvalidatePrefix(prefix)
+	})
+}
+
+// InvalidatePattern deletes the entries whose key matches the pattern in every tier. It implements Invalidator.
+func (c *TieredCache) InvalidatePattern(pattern string) (int, error) {
+	n, _ := c.l1.InvalidatePattern(pattern)
+
+	return c.invalidate(n, tieredPattern, []string{pattern}, func() (int, error) {
+		return c.l2.InvalidatePattern(pattern)
+	})
+}
+
+// invalidate runs the L2 invalidation and broadcasts it, after L1 deleted l1Deleted entries.
+func (c *TieredCache) invalidate(l1Deleted int, op string, keys []string, l2 func() (int, error)) (int, error) {
+	if c.degraded.Load() {
+		return l1Deleted, nil
+	}
+
+	n, err := l2()
+	if c.fail(err) != nil {
+		return l1Deleted, err
+	}
+
+	c.publish(op, keys...)
+
+	return n, nil
+}
+
+// Lock acquires the lock named key in L2, so a single replica runs the work it guards. It implements Locker.
+func (c *TieredCache) Lock(key string, ttl time.Duration) (func(), bool, error) {
+	if c.degraded.Load() {
+		return nil, false, ErrorTieredCacheDegraded
+	}
+
+	unlock, ok, err := c.l2.Lock(key, ttl)
+
+	return unlock, ok, c.fail(err)
+}
+
+// Stats returns the number of reads served by each tier.
+func (c *TieredCache) Stats() TieredCacheStats {
+	return TieredCacheStats{
+		L1Hits:   c.l1Hits.Load(),
+		L2Hits:   c.l2Hits.Load(),
+		Misses:   c.misses.Load(),
+		L2Errors: c.l2Errors.Load(),
+		Degraded: c.degraded.Load(),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *TieredCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tieredHitsDesc
+	ch <- tieredMissesDesc
+	ch <- tieredErrorsDesc
+	ch <- tieredDegradedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *TieredCache) Collect(ch chan<- prometheus.Metric) {
+	stats := c.Stats()
+
+	degraded := 0.0
+	if stats.Degraded {
+		degraded = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(tieredHitsDesc, prometheus.CounterValue, float64(stats.L1Hits), "l1")
+	ch <- prometheus.MustNewConstMetric(tieredHitsDesc, prometheus.CounterValue, float64(stats.L2Hits), "l2")
+	ch <- prometheus.MustNewConstMetric(tieredMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(tieredErrorsDesc, prometheus.CounterValue, float64(stats.L2Errors))
+	ch <- prometheus.MustNewConstMetric(tieredDegradedDesc, prometheus.GaugeValue, degraded)
+}
+
+// Close unsubscribes from the invalidation channel and closes both tiers.
+func (c *TieredCache) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	err := c.pubsub.Close()
+	c.l1.Close()
+
+	return errors.Join(err, c.l2.Close())
+}
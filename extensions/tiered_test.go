@@ -0,0 +1,161 @@
+package extensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newDegradedTieredCache returns a TieredCache whose Redis is unreachable, and the number of reported errors.
+func newDegradedTieredCache(t *testing.T) (*TieredCache, *atomic.Int32) {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	l2 := &RedisCache{client: client, ttl: time.Minute, prefix: "app:", codec: RawCodec, ctx: context.Background()}
+
+	var errs atomic.Int32
+	c, err := NewTieredCache(NewMapCache(), l2, &TieredCacheOption{
+		L1TTL:         time.Minute,
+		Channel:       "test:invalidate",
+		RetryInterval: time.Hour,
+		OnError: func(err error) {
+			errs.Add(1)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTieredCache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, &errs
+}
+
+func TestTieredCacheDegraded(t *testing.T) {
+	c, errs := newDegradedTieredCache(t)
+
+	if !c.Stats().Degraded || errs.Load() == 0 {
+		t.Fatalf("stats = %+v, errors = %d, want the cache degraded to L1", c.Stats(), errs.Load())
+	}
+
+	if err := c.Set("users:1", "gopher"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	c.Tag("users:1", "users")
+	c.Set("posts:1", "hello")
+
+	if value, ok := c.Get("users:1"); !ok || value != "gopher" {
+		t.Errorf("Get = %v, %v, want the L1 entry", value, ok)
+	}
+
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Get of a missing key succeeded")
+	}
+
+	if stats := c.Stats(); stats.L1Hits != 1 || stats.L2Hits != 0 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want one L1 hit and one miss", stats)
+	}
+
+	if _, _, err := c.Lock("users:1", time.Second); !errors.Is(err, ErrorTieredCacheDegraded) {
+		t.Errorf("Lock error = %v, want %v", err, ErrorTieredCacheDegraded)
+	}
+
+	if n, err := c.InvalidateTags("users"); n != 1 || err != nil || c.Exists("users:1") {
+		t.Errorf("InvalidateTags = %d, %v, want the L1 entry deleted", n, err)
+	}
+
+	if err := c.Delete("posts:1"); err != nil || c.Exists("posts:1") {
+		t.Errorf("Delete = %v, want the L1 entry deleted", err)
+	}
+}
+
+func TestTieredCacheApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		message tieredMessage
+		want    []string
+	}{
+		{"delete", tieredMessage{Op: tieredDelete, Keys: []string{"users:1", "posts:1"}}, []string{"users:2", "tagged:1"}},
+		{"tags", tieredMessage{Op: tieredTags, Keys: []string{"tag"}}, []string{"users:1", "users:2", "posts:1"}},
+		{"prefix", tieredMessage{Op: tieredPrefix, Keys: []string{"users:"}}, []string{"posts:1", "tagged:1"}},
+		{"pattern", tieredMessage{Op: tieredPattern, Keys: []string{"*:1"}}, []string{"users:2"}},
+		{"unknown operation", tieredMessage{Op: "flush", Keys: []string{"users:1"}}, []string{"users:1", "users:2", "posts:1", "tagged:1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newDegradedTieredCache(t)
+
+			// L1 entries filled from L2 have no tags, only the entries tagged in this replica do.
+			for _, key := range []string{"users:1", "users:2", "posts:1", "tagged:1"} {
+				c.l1.Set(key, key)
+			}
+			c.l1.Tag("tagged:1", "tag")
+
+			c.apply(tt.message)
+
+			if got := c.l1.Len(); got != len(tt.want) {
+				t.Errorf("L1 holds %d entries, want %v", got, tt.want)
+			}
+
+			for _, key := range tt.want {
+				if !c.l1.Exists(key) {
+					t.Errorf("%q was deleted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{redis.Nil, false},
+		{errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), false},
+		{io.EOF, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{context.DeadlineExceeded, true},
+		{redis.ErrClosed, true},
+		{redis.ErrPoolTimeout, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+	}
+
+	for _, tt := range tests {
+		if got := unreachable(tt.err); got != tt.want {
+			t.Errorf("unreachable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestTieredCacheL1Expiration(t *testing.T) {
+	c := &TieredCache{TieredCacheOption: &TieredCacheOption{L1TTL: time.Minute}}
+	limit := time.Now().Add(time.Minute).Unix()
+	soon := time.Now().Add(10 * time.Second).Unix()
+
+	tests := []struct {
+		name       string
+		expiration int64
+		want       int64
+	}{
+		{"without expiration", 0, limit},
+		{"after L1TTL", time.Now().Add(time.Hour).Unix(), limit},
+		{"before L1TTL", soon, soon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.l1Expiration(tt.expiration); got < tt.want || got > tt.want+1 {
+				t.Errorf("l1Expiration = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
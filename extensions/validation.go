@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"reflect"
 )
 
 type contextKey string
@@ -16,6 +17,8 @@ type ValidationError struct {
 	Message string         `json:"message"`
 	Code    int            `json:"code"`
 	Fields  map[string]any `json:"fields,omitempty"`
+	// Codes holds the stable code of every failed field, e.g. `required`, next to the localized message in Fields.
+	Codes map[string]string `json:"codes,omitempty"`
 }
 
 func (e ValidationError) Error() string {
@@ -32,18 +35,31 @@ type Validation interface {
 	Validate() error
 }
 
-// ValidationMiddleware is a middleware that validates the request body against the Validation interface.
-func ValidationMiddleware[T Validation](next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// ValidationMiddleware is a middleware that binds the request into T (see Bind), then validates it against
+// the `validate` struct tags of T and the Validation interface if T implements it (see Validate).
+// Messages are localized with the locale of the request (see RequestLocale).
+// It panics if the `validate` struct tags of T are invalid (see ValidateTags).
+// The bound value is stored in the request context under BodyKey. Describe requests only record T, without calling next.
+func ValidationMiddleware[T any](next http.HandlerFunc) http.HandlerFunc {
+	if err := ValidateTags(reflect.TypeFor[T]()); err != nil {
+		panic(err)
+	}
+
+	return Describer(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := Describe(r); ok {
+			d.Request = reflect.TypeFor[T]()
+			return
+		}
+
 		var data T
-		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		if err := Bind(r, &data); err != nil {
 			panic(err)
 		}
 
-		if err := data.Validate(); err != nil {
+		if err := ValidateLocale(&data, RequestLocale(r)); err != nil {
 			panic(err)
 		}
 
 		next(w, r.WithContext(context.WithValue(r.Context(), BodyKey, data)))
-	}
+	})
 }
@@ -0,0 +1,538 @@
+package extensions
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidationRule checks a field value against the rule parameter, e.g. `8` for `min=8`. It returns false if the value is invalid.
+// Pointers are dereferenced before the rule is called, and nil pointers are only checked by `required`.
+type ValidationRule func(value reflect.Value, param string) bool
+
+type validationRule struct {
+	check   ValidationRule
+	message string // message is used when the message catalog doesn't know the rule.
+}
+
+// validationResult collects the localized messages and the codes of the failed fields.
+type validationResult struct {
+	locale string
+	fields map[string]any
+	codes  map[string]string
+}
+
+func newValidationResult(locale string) *validationResult {
+	return &validationResult{
+		locale: locale,
+		fields: make(map[string]any),
+		codes:  make(map[string]string),
+	}
+}
+
+// add records the failure of the field with the message of the code in the result locale.
+func (res *validationResult) add(field, code, fallback, param string) {
+	res.fields[field] = translate(res.locale, code, fallback, field, param)
+	res.codes[field] = code
+}
+
+// error returns the ValidationError of the failures with the message of the code, or nil if there are none.
+func (res *validationResult) error(code string, status int) error {
+	if len(res.fields) == 0 {
+		return nil
+	}
+
+	return ValidationError{
+		Message: translate(res.locale, code, http.StatusText(status), "", ""),
+		Code:    status,
+		Fields:  res.fields,
+		Codes:   res.codes,
+	}
+}
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	alphaPattern    = regexp.MustCompile(`^[A-Za-z]+$`)
+	alphanumPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	numericPattern  = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
+)
+
+var (
+	validationRules = map[string]validationRule{
+		"required": {check: ruleRequired},
+		"email":    {check: ruleEmail},
+		"url":      {check: ruleURL},
+		"uuid":     {check: rulePattern(uuidPattern)},
+		"alpha":    {check: rulePattern(alphaPattern)},
+		"alphanum": {check: rulePattern(alphanumPattern)},
+		"numeric":  {check: rulePattern(numericPattern)},
+		"min":      {check: ruleCompare(func(n, p float64) bool { return n >= p })},
+		"max":      {check: ruleCompare(func(n, p float64) bool { return n <= p })},
+		"len":      {check: ruleCompare(func(n, p float64) bool { return n == p })},
+		"gt":       {check: ruleCompare(func(n, p float64) bool { return n > p })},
+		"gte":      {check: ruleCompare(func(n, p float64) bool { return n >= p })},
+		"lt":       {check: ruleCompare(func(n, p float64) bool { return n < p })},
+		"lte":      {check: ruleCompare(func(n, p float64) bool { return n <= p })},
+		"eq":       {check: ruleEqual},
+		"ne":       {check: func(v reflect.Value, p string) bool { return !ruleEqual(v, p) }},
+		"oneof":    {check: ruleOneOf},
+	}
+	validationRulesMutex sync.RWMutex
+	validationTypes      sync.Map // map[reflect.Type]*validationType
+)
+
+// validationTag is a parsed `validate` struct tag.
+type validationTag struct {
+	omitempty bool
+	rules     []tagRule
+	dive      *validationTag // dive holds the rules of the elements, or nil if the tag has no `dive`.
+}
+
+type tagRule struct {
+	name  string
+	param string
+	rule  validationRule
+}
+
+// validationType is the parsed validation of a type.
+type validationType struct {
+	tagged bool             // tagged reports whether the type, or any type nested in it, has `validate` struct tags.
+	fields []*validationTag // fields holds the parsed tag of every struct field, or nil for the untagged fields.
+	err    error            // err is the first invalid tag of the type or the types nested in it.
+}
+
+// RegisterValidationRule registers a custom rule that can be used in `validate` struct tags.
+// The message may contain the `{field}` and `{param}` placeholders, and is used when the message catalog
+// has no translation for the rule name. Registering an existing name replaces the rule.
+func RegisterValidationRule(name, message string, rule ValidationRule) {
+	validationRulesMutex.Lock()
+	defer validationRulesMutex.Unlock()
+
+	validationRules[name] = validationRule{
+		check:   rule,
+		message: message,
+	}
+
+	// The parsed tags hold the rules, so they are parsed again with the new rule.
+	validationTypes.Clear()
+}
+
+// ValidateTags parses the `validate` struct tags of the type and of the types nested in it, and returns an error
+// if a tag uses an unknown rule. Tags are parsed once per type, and typed handlers and ValidationMiddleware check
+// them when they are created, so an invalid tag fails when the route is registered instead of on every request.
+func ValidateTags(t reflect.Type) error {
+	if t == nil {
+		return nil
+	}
+
+	return typeValidation(t).err
+}
+
+// Validate validates v, usually a pointer to a request struct, against its `validate` struct tags,
+// for example `validate:"required,email,min=8,max=64,oneof=a b"`. Nested structs, slices and maps are validated
+// recursively, and `dive` applies the following rules to every element of a slice or map. `omitempty` skips
+// the other rules of an empty value wherever it appears. Tags with an unknown rule fail, see ValidateTags.
+// If v, or a value v points to, implements Validation, its Validate method runs after the tag rules pass.
+// Tag failures are returned as ValidationError with status 400, keyed by the JSON path of the field, e.g. `items[0].name`.
+// Messages use DefaultLocale, see ValidateLocale.
+func Validate(v any) error {
+	return ValidateLocale(v, DefaultLocale)
+}
+
+// ValidateLocale is like Validate, but the messages are translated to the locale with the message catalog.
+// The rule name of every failed field is reported in ValidationError.Codes.
+func ValidateLocale(v any, locale string) error {
+	rv := reflect.ValueOf(v)
+	if rv.IsValid() {
+		vt := typeValidation(rv.Type())
+		if vt.err != nil {
+			return vt.err
+		}
+
+		if vt.tagged {
+			res := newValidationResult(locale)
+			validateValue(rv, "", res)
+
+			if err := res.error(CodeInvalidRequestBody, http.StatusBadRequest); err != nil {
+				return err
+			}
+		}
+	}
+
+	// v is usually a pointer to the bound value, so the pointers are followed to find the Validate method of the value,
+	// e.g. the method of *P when v is a **P. Nil pointers are skipped.
+	for rv.IsValid() && (rv.Kind() != reflect.Pointer || !rv.IsNil()) {
+		if validation, ok := rv.Interface().(Validation); ok {
+			return validation.Validate()
+		}
+
+		if rv.Kind() != reflect.Pointer {
+			break
+		}
+
+		rv = rv.Elem()
+	}
+
+	return nil
+}
+
+// typeValidation returns the parsed validation of the type, parsing it the first time.
+func typeValidation(t reflect.Type) *validationType {
+	if vt, ok := validationTypes.Load(t); ok {
+		return vt.(*validationType)
+	}
+
+	vt := &validationType{}
+	vt.tagged, vt.err = lookupValidationTags(t, make(map[reflect.Type]bool))
+
+	if t.Kind() == reflect.Struct {
+		vt.fields = make([]*validationTag, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if tag := t.Field(i).Tag.Get("validate"); tag != "" && tag != "-" {
+				vt.fields[i], _ = parseValidationTag(tag)
+			}
+		}
+	}
+
+	validationTypes.Store(t, vt)
+
+	return vt
+}
+
+// lookupValidationTags reports whether the type, or any type nested in it, has `validate` struct tags,
+// and returns the first tag that fails to parse.
+func lookupValidationTags(t reflect.Type, visited map[reflect.Type]bool) (bool, error) {
+	if visited[t] {
+		return false, nil
+	}
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return lookupValidationTags(t.Elem(), visited)
+	case reflect.Struct:
+		tagged := false
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() && !field.Anonymous {
+				continue
+			}
+
+			if tag := field.Tag.Get("validate"); tag != "" {
+				tagged = true
+				if tag != "-" {
+					if _, err := parseValidationTag(tag); err != nil {
+						return true, fmt.Errorf("invalid validate tag on %s.%s: %w", t, field.Name, err)
+					}
+				}
+			}
+
+			nested, err := lookupValidationTags(field.Type, visited)
+			if err != nil {
+				return true, err
+			}
+
+			tagged = tagged || nested
+		}
+
+		return tagged, nil
+	}
+
+	return false, nil
+}
+
+// parseValidationTag parses the comma separated rules of a `validate` struct tag. `omitempty` may appear anywhere
+// before `dive`, and the rules after `dive` apply to the elements.
+func parseValidationTag(tag string) (*validationTag, error) {
+	parsed := &validationTag{}
+
+	tokens := strings.Split(tag, ",")
+	for i, token := range tokens {
+		name, param, _ := strings.Cut(strings.TrimSpace(token), "=")
+
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			parsed.omitempty = true
+			continue
+		case "dive":
+			dive, err := parseValidationTag(strings.Join(tokens[i+1:], ","))
+			if err != nil {
+				return nil, err
+			}
+
+			parsed.dive = dive
+			return parsed, nil
+		}
+
+		validationRulesMutex.RLock()
+		rule, ok := validationRules[name]
+		validationRulesMutex.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("unknown validation rule %q", name)
+		}
+
+		parsed.rules = append(parsed.rules, tagRule{name: name, param: param, rule: rule})
+	}
+
+	return parsed, nil
+}
+
+// jsonFieldName returns the JSON name of the struct field, or "-" if the field is ignored by encoding/json.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// validateValue walks the value and validates the tagged fields of every struct it contains.
+func validateValue(v reflect.Value, path string, res *validationResult) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+
+		v = v.Elem()
+	}
+
+	vt := typeValidation(v.Type())
+	if !vt.tagged {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				validateValue(v.Field(i), path, res)
+				continue
+			}
+
+			if !field.IsExported() {
+				continue
+			}
+
+			fieldPath := joinFieldPath(path, name)
+			if tag := vt.fields[i]; tag != nil {
+				if !validateField(v.Field(i), tag, fieldPath, res) {
+					continue
+				}
+			}
+
+			validateValue(v.Field(i), fieldPath, res)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), res)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), joinFieldPath(path, valueString(iter.Key())), res)
+		}
+	}
+}
+
+// validateField applies the rules of the tag to the value. It returns false if a rule failed.
+func validateField(v reflect.Value, tag *validationTag, path string, res *validationResult) bool {
+	if tag.omitempty && isEmptyValue(v) {
+		return true
+	}
+
+	for _, rule := range tag.rules {
+		value := v
+		if rule.name != "required" {
+			for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+				if value.IsNil() {
+					break
+				}
+
+				value = value.Elem()
+			}
+
+			if (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) && value.IsNil() {
+				continue
+			}
+		}
+
+		if !rule.rule.check(value, rule.param) {
+			res.add(path, rule.name, rule.rule.message, rule.param)
+			return false
+		}
+	}
+
+	if tag.dive == nil {
+		return true
+	}
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+
+		v = v.Elem()
+	}
+
+	valid := true
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			if !validateField(v.Index(i), tag.dive, elementPath, res) {
+				valid = false
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elementPath := joinFieldPath(path, valueString(iter.Key()))
+			if !validateField(iter.Value(), tag.dive, elementPath, res) {
+				valid = false
+			}
+		}
+	}
+
+	return valid
+}
+
+// valueString formats the value, including values read through unexported fields.
+func valueString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+	}
+
+	if v.CanInterface() {
+		return fmt.Sprint(v.Interface())
+	}
+
+	return v.String()
+}
+
+func formatValidationMessage(message, field, param string) string {
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(message)
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func ruleRequired(v reflect.Value, _ string) bool {
+	return v.IsValid() && !isEmptyValue(v)
+}
+
+func ruleEmail(v reflect.Value, _ string) bool {
+	if v.Kind() != reflect.String {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(v.String())
+
+	return err == nil && addr.Address == v.String()
+}
+
+func ruleURL(v reflect.Value, _ string) bool {
+	if v.Kind() != reflect.String {
+		return false
+	}
+
+	u, err := url.Parse(v.String())
+
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func rulePattern(pattern *regexp.Regexp) ValidationRule {
+	return func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && pattern.MatchString(v.String())
+	}
+}
+
+// ruleCompare compares the length of strings, slices and maps, or the value of numbers, with the rule parameter.
+func ruleCompare(compare func(n, param float64) bool) ValidationRule {
+	return func(v reflect.Value, param string) bool {
+		p, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+
+		switch v.Kind() {
+		case reflect.String:
+			return compare(float64(utf8.RuneCountInString(v.String())), p)
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return compare(float64(v.Len()), p)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compare(float64(v.Int()), p)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return compare(float64(v.Uint()), p)
+		case reflect.Float32, reflect.Float64:
+			return compare(v.Float(), p)
+		default:
+			return false
+		}
+	}
+}
+
+func ruleEqual(v reflect.Value, param string) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String() == param
+	case reflect.Bool:
+		b, err := strconv.ParseBool(param)
+		return err == nil && v.Bool() == b
+	default:
+		return ruleCompare(func(n, p float64) bool { return n == p })(v, param)
+	}
+}
+
+func ruleOneOf(v reflect.Value, param string) bool {
+	value := valueString(v)
+	for _, option := range strings.Fields(param) {
+		if value == option {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package extensions
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type testSignup struct {
+	Email    string            `json:"email" validate:"required,email"`
+	Password string            `json:"password" validate:"min=8,max=16"`
+	Role     string            `json:"role" validate:"omitempty,oneof=admin user"`
+	Website  *string           `json:"website" validate:"url,omitempty"`
+	Age      int               `json:"age" validate:"gte=18"`
+	Tags     []string          `json:"tags" validate:"max=3,dive,alpha"`
+	Labels   map[string]string `json:"labels" validate:"dive,required"`
+	Address  testAddress       `json:"address"`
+	Previous []testAddress     `json:"previous"`
+}
+
+func validTestSignup() testSignup {
+	return testSignup{
+		Email:    "gopher@example.com",
+		Password: "password",
+		Age:      30,
+		Address:  testAddress{City: "Jakarta"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	website := "not a url"
+
+	tests := []struct {
+		name   string
+		modify func(s *testSignup)
+		want   map[string]string
+	}{
+		{"valid", func(s *testSignup) {}, nil},
+		{"required", func(s *testSignup) { s.Email = "" }, map[string]string{"email": "required"}},
+		{"email", func(s *testSignup) { s.Email = "gopher" }, map[string]string{"email": "email"}},
+		{"min length", func(s *testSignup) { s.Password = "short" }, map[string]string{"password": "min"}},
+		{"max length", func(s *testSignup) { s.Password = strings.Repeat("x", 17) }, map[string]string{"password": "max"}},
+		{"omitempty skips empty values", func(s *testSignup) { s.Role = "" }, nil},
+		{"oneof", func(s *testSignup) { s.Role = "root" }, map[string]string{"role": "oneof"}},
+		{"omitempty after a rule", func(s *testSignup) { s.Website = &website }, map[string]string{"website": "url"}},
+		{"number", func(s *testSignup) { s.Age = 17 }, map[string]string{"age": "gte"}},
+		{"slice length", func(s *testSignup) { s.Tags = []string{"a", "b", "c", "d"} }, map[string]string{"tags": "max"}},
+		{"dive into a slice", func(s *testSignup) { s.Tags = []string{"go", "1"} }, map[string]string{"tags[1]": "alpha"}},
+		{"dive into a map", func(s *testSignup) { s.Labels = map[string]string{"team": ""} }, map[string]string{"labels.team": "required"}},
+		{"nested struct", func(s *testSignup) { s.Address.City = "" }, map[string]string{"address.city": "required"}},
+		{"struct in a slice", func(s *testSignup) { s.Previous = []testAddress{{City: "Bandung"}, {}} }, map[string]string{"previous[1].city": "required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validTestSignup()
+			tt.modify(&s)
+
+			err := Validate(&s)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate = %v, want a ValidationError", err)
+			}
+
+			if validationErr.Code != http.StatusBadRequest || !maps.Equal(validationErr.Codes, tt.want) {
+				t.Errorf("Validate = %d %v, want 400 %v", validationErr.Code, validationErr.Codes, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     reflect.Type
+		wantErr bool
+	}{
+		{"known rules", reflect.TypeFor[testSignup](), false},
+		{"unknown rule", reflect.TypeFor[struct {
+			Name string `validate:"required,unknown"`
+		}](), true},
+		{"dive is a whole token", reflect.TypeFor[struct {
+			Names []string `validate:"diver"`
+		}](), true},
+		{"unknown rule after dive", reflect.TypeFor[struct {
+			Names []string `validate:"dive,unknown"`
+		}](), true},
+		{"unknown rule in a nested type", reflect.TypeFor[struct {
+			Items []struct {
+				Name string `validate:"unknown"`
+			}
+		}](), true},
+		{"ignored field", reflect.TypeFor[struct {
+			Name string `validate:"-"`
+		}](), false},
+		{"untagged", reflect.TypeFor[int](), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTags(tt.typ); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTags = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var errTestRejected = errors.New("rejected by Validate")
+
+type testValueValidation struct {
+	Name string `json:"name"`
+}
+
+func (v testValueValidation) Validate() error {
+	if v.Name == "reject" {
+		return errTestRejected
+	}
+
+	return nil
+}
+
+type testPointerValidation struct {
+	Name string `json:"name"`
+}
+
+func (v *testPointerValidation) Validate() error {
+	if v.Name == "reject" {
+		return errTestRejected
+	}
+
+	return nil
+}
+
+// serveValidation serves the body through the middleware and returns the error it raised.
+func serveValidation(h http.HandlerFunc, body string) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = recovered.(error)
+		}
+	}()
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	h(httptest.NewRecorder(), r)
+
+	return nil
+}
+
+func TestValidationMiddlewareValidation(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"value receiver on a value", ValidationMiddleware[testValueValidation](next)},
+		{"value receiver on a pointer", ValidationMiddleware[*testValueValidation](next)},
+		{"pointer receiver on a value", ValidationMiddleware[testPointerValidation](next)},
+		{"pointer receiver on a pointer", ValidationMiddleware[*testPointerValidation](next)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := serveValidation(tt.handler, `{"name":"reject"}`); !errors.Is(err, errTestRejected) {
+				t.Errorf("rejected body error = %v, want %v", err, errTestRejected)
+			}
+
+			if err := serveValidation(tt.handler, `{"name":"accept"}`); err != nil {
+				t.Errorf("accepted body error = %v, want nil", err)
+			}
+		})
+	}
+}
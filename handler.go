@@ -0,0 +1,80 @@
+package mahakam
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// StatusCoder can be implemented by typed handler responses to override the default 200 status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+type contextKey string
+
+const errorHandlerKey contextKey = "errorHandler"
+
+// HandlerFunc is a typed handler that receives the bound request and returns the response to encode.
+type HandlerFunc[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+// Handle wraps a typed handler into an http.HandlerFunc.
+// The request is bound with extensions.Bind, so path values, query parameters, headers and the JSON body
+// are read from the `path`, `query`, `header` and `json` struct tags. The request is then validated with
+// extensions.ValidateLocale in the locale of the request, using the `validate` struct tags and the Validation interface.
+// The response is encoded with Respond according to the `Accept` header.
+// It panics if the `validate` struct tags of Req are invalid (see extensions.ValidateTags).
+// Errors are passed to the server's ErrorHandler. When the handler isn't served by a Server, e.g. on a plain
+// ServeMux, errors are answered like the default ErrorHandler of NewServer does.
+func Handle[Req, Resp any](handler HandlerFunc[Req, Resp]) http.HandlerFunc {
+	if err := extensions.ValidateTags(reflect.TypeFor[Req]()); err != nil {
+		panic(err)
+	}
+
+	return extensions.Describer(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := extensions.Describe(r); ok {
+			d.Request = reflect.TypeFor[Req]()
+			d.Response = reflect.TypeFor[Resp]()
+			return
+		}
+
+		var req Req
+		if err := extensions.Bind(r, &req); err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		if err := extensions.ValidateLocale(&req, extensions.RequestLocale(r)); err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		resp, err := handler(r.Context(), req)
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		status := http.StatusOK
+		if s, ok := any(resp).(StatusCoder); ok {
+			status = s.StatusCode()
+		}
+
+		if err := Respond(w, r, status, resp); err != nil {
+			handleError(w, r, err)
+		}
+	})
+}
+
+// handleError passes err to the ErrorHandler of the server, stored in the request context by Server.dispatch,
+// or to the default one when there is none.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if handler, ok := r.Context().Value(errorHandlerKey).(func(http.ResponseWriter, *http.Request, error)); ok && handler != nil {
+		handler(w, r, err)
+		return
+	}
+
+	defaultErrorHandler(w, r, err)
+}
@@ -0,0 +1,97 @@
+package mahakam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testUserRequest struct {
+	ID   string `path:"id"`
+	Name string `json:"name" validate:"required"`
+}
+
+type testUserResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (testUserResponse) StatusCode() int {
+	return http.StatusCreated
+}
+
+var errTestHandler = errors.New("handler failed")
+
+func testUserHandler(ctx context.Context, req testUserRequest) (testUserResponse, error) {
+	if req.Name == "fail" {
+		return testUserResponse{}, errTestHandler
+	}
+
+	return testUserResponse{ID: req.ID, Name: req.Name}, nil
+}
+
+func TestHandle(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /users/{id}", Handle(testUserHandler))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"bound and encoded", `{"name":"gopher"}`, http.StatusCreated, `{"id":"42","name":"gopher"}`},
+		{"malformed body", `{"name":`, http.StatusBadRequest, ""},
+		{"failed validation", `{}`, http.StatusBadRequest, ""},
+		{"handler error", `{"name":"fail"}`, http.StatusInternalServerError, errTestHandler.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			// Without a Server in front, errors are answered by the default ErrorHandler instead of a panic.
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+
+			if tt.wantStatus == http.StatusBadRequest {
+				var validationErr map[string]any
+				if err := json.Unmarshal(w.Body.Bytes(), &validationErr); err != nil || validationErr["code"] != float64(http.StatusBadRequest) {
+					t.Errorf("body = %q, want a ValidationError", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandleServerErrorHandler(t *testing.T) {
+	s := NewServer("", http.NewServeMux())
+	s.HandleFunc("POST /users/{id}", Handle(testUserHandler))
+
+	var handled error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(`{"name":"fail"}`))
+	w := httptest.NewRecorder()
+	s.dispatch(w, r)
+
+	if !errors.Is(handled, errTestHandler) || w.Code != http.StatusTeapot {
+		t.Errorf("ErrorHandler got %v and answered %d, want %v and %d", handled, w.Code, errTestHandler, http.StatusTeapot)
+	}
+}
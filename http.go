@@ -7,7 +7,7 @@ import (
 
 type httpFramework struct {
 	Address         string
-	mux             *http.ServeMux
+	handler         http.HandlerFunc
 	middleware      []func(http.HandlerFunc) http.HandlerFunc
 	ErrorHandler    func(http.ResponseWriter, *http.Request, error)
 	certificatePath string
@@ -15,12 +15,8 @@ type httpFramework struct {
 }
 
 func (s *httpFramework) listenAndServe() error {
-	if s.mux == nil {
-		s.mux = http.NewServeMux()
-	}
-
-	var handler http.Handler = s.mux
-	if len(s.middleware) > 0 {
+	var handler http.Handler = s.handler
+	if len(s.middleware) > 0 || s.ErrorHandler != nil {
 		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if recovered := recover(); recovered != nil {
@@ -41,9 +37,7 @@ func (s *httpFramework) listenAndServe() error {
 				}
 			}()
 
-			h := func(w http.ResponseWriter, r *http.Request) {
-				s.mux.ServeHTTP(w, r)
-			}
+			h := s.handler
 
 			for i := len(s.middleware) - 1; i >= 0; i-- {
 				h = s.middleware[i](h)
@@ -57,12 +51,8 @@ func (s *httpFramework) listenAndServe() error {
 }
 
 func (s *httpFramework) listenAndServeTLS() error {
-	if s.mux == nil {
-		s.mux = http.NewServeMux()
-	}
-
-	var handler http.Handler = s.mux
-	if len(s.middleware) > 0 {
+	var handler http.Handler = s.handler
+	if len(s.middleware) > 0 || s.ErrorHandler != nil {
 		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if recovered := recover(); recovered != nil {
@@ -83,9 +73,7 @@ func (s *httpFramework) listenAndServeTLS() error {
 				}
 			}()
 
-			h := func(w http.ResponseWriter, r *http.Request) {
-				s.mux.ServeHTTP(w, r)
-			}
+			h := s.handler
 
 			for i := len(s.middleware) - 1; i >= 0; i-- {
 				h = s.middleware[i](h)
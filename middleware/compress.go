@@ -0,0 +1,392 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ENCODING_ZSTD    = "zstd"
+	ENCODING_GZIP    = "gzip"
+	ENCODING_DEFLATE = "deflate"
+)
+
+// CompressOption defines the configuration options for the compression middleware.
+type CompressOption struct {
+	// Encodings are the supported encodings. When the client accepts several of them equally, the first one is used.
+	Encodings []string
+	// Level is the compression level, from 1 (fastest) to 9 (best). Zero or negative uses the default level of each encoding.
+	Level int
+	// MinSize is the minimum size in bytes of the body to compress. Smaller bodies are sent as is,
+	// unless the handler flushes the response before reaching it.
+	MinSize int
+	// SkipContentTypes are the content types, or prefixes like `image/`, that are already compressed and sent as is.
+	SkipContentTypes []string
+}
+
+// DefaultCompressMiddlewareOption provides default values for compression options.
+var DefaultCompressMiddlewareOption = CompressOption{
+	Encodings: []string{ENCODING_ZSTD, ENCODING_GZIP, ENCODING_DEFLATE},
+	Level:     0,
+	MinSize:   1024,
+	SkipContentTypes: []string{
+		"image/",
+		"video/",
+		"audio/",
+		"font/woff",
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/zstd",
+		"application/x-bzip2",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+		"application/pdf",
+		"application/octet-stream",
+		"text/event-stream",
+	},
+}
+
+// encoder is a compressing writer that can be reused with Reset.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compression is a middleware that compresses responses with the encoding negotiated from `Accept-Encoding`.
+// Encoders are pooled per encoding.
+//
+// Register it outside extensions.CacheMiddleware, so the cache stores the uncompressed bytes once and cached responses
+// are compressed for each client. Inside the cache, compressed responses are stored as a variant of the exact
+// `Accept-Encoding` value, because the middleware adds `Vary: Accept-Encoding` and the cache only stores encoded
+// bodies that vary on it, so the same encoding is stored again for every distinct `Accept-Encoding` header.
+type Compression struct {
+	*CompressOption
+	pools map[string]*sync.Pool
+}
+
+// NewCompressMiddleware creates a new compression middleware. if option is nil, it uses the default options.
+func NewCompressMiddleware(option *CompressOption) *Compression {
+	if option == nil {
+		option = &DefaultCompressMiddlewareOption
+	}
+
+	c := &Compression{
+		CompressOption: option,
+		pools:          make(map[string]*sync.Pool),
+	}
+
+	for _, encoding := range option.Encodings {
+		var newEncoder func() any
+		switch encoding {
+		case ENCODING_GZIP:
+			level := compressLevel(option.Level, gzip.DefaultCompression, gzip.BestCompression)
+
+			newEncoder = func() any {
+				w, _ := gzip.NewWriterLevel(io.Discard, level)
+				return w
+			}
+		case ENCODING_DEFLATE:
+			level := compressLevel(option.Level, flate.DefaultCompression, flate.BestCompression)
+
+			newEncoder = func() any {
+				w, _ := flate.NewWriter(io.Discard, level)
+				return w
+			}
+		case ENCODING_ZSTD:
+			level := zstd.SpeedDefault
+			if option.Level > 0 {
+				level = zstd.EncoderLevelFromZstd(option.Level)
+			}
+
+			newEncoder = func() any {
+				w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+				return w
+			}
+		default:
+			continue
+		}
+
+		c.pools[encoding] = &sync.Pool{New: newEncoder}
+	}
+
+	return c
+}
+
+// compressLevel returns the level within the range of the encoding, or its default level if level is not set.
+func compressLevel(level, defaultLevel, bestLevel int) int {
+	if level <= 0 {
+		return defaultLevel
+	}
+
+	if level > bestLevel {
+		return bestLevel
+	}
+
+	return level
+}
+
+// Compress returns a compression middleware with the given options. if option is nil, it uses the default options.
+func Compress(option *CompressOption) func(http.HandlerFunc) http.HandlerFunc {
+	return NewCompressMiddleware(option).Middleware
+}
+
+// negotiate returns the supported encoding with the highest q-value in `Accept-Encoding`, or an empty string.
+func (c *Compression) negotiate(r *http.Request) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(strings.Join(r.Header.Values("Accept-Encoding"), ","), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range c.Encodings {
+		if _, ok := c.pools[encoding]; !ok {
+			continue
+		}
+
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+func (c *Compression) skipContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, skip := range c.SkipContentTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Middleware returns an HTTP middleware function that compresses the response.
+func (c *Compression) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+
+		encoding := c.negotiate(r)
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			compression:    c,
+			encoding:       encoding,
+			status:         http.StatusOK,
+		}
+		// A panic is reported by the ErrorHandler of the server, so the response is left untouched for it.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				cw.release()
+				panic(recovered)
+			}
+		}()
+
+		next(cw, r)
+		cw.close()
+	}
+}
+
+// addVary adds the header name to the `Vary` header, unless it is already listed.
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), name) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", name)
+}
+
+// compressWriter buffers the beginning of the body until MinSize is reached, then decides whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	compression *Compression
+	encoding    string
+	status      int
+	buf         []byte
+	encoder     encoder
+	decided     bool
+	passthrough bool
+	hijacked    bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+
+	cw.status = code
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.compression.MinSize {
+			return len(p), nil
+		}
+
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(p)
+	}
+
+	return cw.encoder.Write(p)
+}
+
+// decide sends the headers, compressing the response if compress is set and the response is compressible,
+// then writes the buffered body.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	cw.passthrough = !compress ||
+		header.Get("Content-Encoding") != "" ||
+		header.Get("Content-Range") != "" ||
+		cw.compression.skipContentType(header.Get("Content-Type"))
+
+	if cw.passthrough {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		if len(cw.buf) == 0 {
+			return nil
+		}
+
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+		return err
+	}
+
+	header.Set("Content-Encoding", cw.encoding)
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.encoder = cw.compression.pools[cw.encoding].Get().(encoder)
+	cw.encoder.Reset(cw.ResponseWriter)
+
+	_, err := cw.encoder.Write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+// FlushError sends the data written so far to the client. A response flushed before reaching MinSize is
+// still compressed, as streamed responses are usually larger.
+func (cw *compressWriter) FlushError() error {
+	if cw.hijacked {
+		return http.ErrHijacked
+	}
+
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return err
+		}
+	}
+
+	if cw.encoder != nil {
+		if err := cw.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Flush() {
+	cw.FlushError()
+}
+
+// Hijack takes over the connection, used by websockets. It fails once the response is started.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.decided || len(cw.buf) > 0 {
+		return nil, nil, http.ErrBodyNotAllowed
+	}
+
+	conn, rw, err := http.NewResponseController(cw.ResponseWriter).Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+
+	return conn, rw, err
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response: small bodies are sent as is, and the encoder is closed and returned to the pool.
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.compression.MinSize && len(cw.buf) > 0)
+	}
+
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+
+	cw.release()
+}
+
+// release returns the encoder to the pool without finishing the response.
+func (cw *compressWriter) release() {
+	if cw.encoder != nil {
+		cw.encoder.Reset(io.Discard)
+		cw.compression.pools[cw.encoding].Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
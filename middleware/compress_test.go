@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// recoverErrors answers the errors raised with panic like the ErrorHandler of the server.
+func recoverErrors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				code := http.StatusInternalServerError
+				if err, ok := recovered.(extensions.ValidationError); ok {
+					code = err.Code
+				}
+
+				w.WriteHeader(code)
+				w.Write([]byte(http.StatusText(code)))
+			}
+		}()
+
+		next(w, r)
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case ENCODING_GZIP:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		r = gr
+	case ENCODING_DEFLATE:
+		r = flate.NewReader(bytes.NewReader(body))
+	case ENCODING_ZSTD:
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("zstd: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return string(body)
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decode %s: %v", encoding, err)
+	}
+
+	return string(decoded)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("compressible text ", 100)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantEncoding   string
+	}{
+		{"gzip", "gzip", "text/plain", large, ENCODING_GZIP},
+		{"deflate", "deflate", "text/plain", large, ENCODING_DEFLATE},
+		{"zstd", "zstd", "text/plain", large, ENCODING_ZSTD},
+		{"first configured encoding", "gzip, zstd, deflate", "text/plain", large, ENCODING_ZSTD},
+		{"highest q-value", "zstd;q=0.5, gzip", "text/plain", large, ENCODING_GZIP},
+		{"wildcard", "*", "text/plain", large, ENCODING_ZSTD},
+		{"excluded encoding", "zstd;q=0, gzip;q=0.1", "text/plain", large, ENCODING_GZIP},
+		{"identity", "", "text/plain", large, ""},
+		{"unsupported encoding", "br", "text/plain", large, ""},
+		{"below MinSize", "gzip", "text/plain", "small", ""},
+		{"compressed content type", "gzip", "image/png", large, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Compress(nil)(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Content-Length", "1")
+				w.Write([]byte(tt.body))
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+
+			if tt.wantEncoding != "" && w.Header().Get("Content-Length") != "" {
+				t.Error("Content-Length of the uncompressed body was kept")
+			}
+
+			if got := decodeBody(t, tt.wantEncoding, w.Body.Bytes()); got != tt.body {
+				t.Errorf("decoded body = %q, want %q", got, tt.body)
+			}
+
+			if got := w.Header().Values("Vary"); !slices.Equal(got, []string{"Accept-Encoding"}) {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+		})
+	}
+}
+
+func TestCompressHeaders(t *testing.T) {
+	large := strings.Repeat("compressible text ", 100)
+
+	handler := Compress(nil)(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(large))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	w.Header().Set("Vary", "accept-encoding, Origin")
+	handler(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", w.Code)
+	}
+
+	if got := w.Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf("ETag = %q, want the weak validator of the compressed body", got)
+	}
+
+	if got := w.Header().Values("Vary"); !slices.Equal(got, []string{"accept-encoding, Origin"}) {
+		t.Errorf("Vary = %q, want Accept-Encoding listed once", got)
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	handler := Compress(nil)(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event 1\n"))
+		http.NewResponseController(w).Flush()
+		w.Write([]byte("event 2\n"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if !w.Flushed || w.Header().Get("Content-Encoding") != ENCODING_GZIP {
+		t.Fatalf("flushed = %v, Content-Encoding = %q, want a compressed stream below MinSize", w.Flushed, w.Header().Get("Content-Encoding"))
+	}
+
+	if got := decodeBody(t, ENCODING_GZIP, w.Body.Bytes()); got != "event 1\nevent 2\n" {
+		t.Errorf("decoded body = %q", got)
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	large := strings.Repeat("compressible text ", 100)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"before writing", func(w http.ResponseWriter, r *http.Request) {
+			panic(extensions.ValidationError{Message: "invalid body", Code: http.StatusBadRequest})
+		}},
+		{"after a small write", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			panic(extensions.ValidationError{Message: "invalid body", Code: http.StatusBadRequest})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := recoverErrors(Compress(nil)(tt.handler))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != http.StatusBadRequest || w.Body.String() != http.StatusText(http.StatusBadRequest) {
+				t.Errorf("response = %d %q, want the 400 of the error handler", w.Code, w.Body.String())
+			}
+
+			if w.Header().Get("Content-Encoding") != "" {
+				t.Error("the error response is marked as compressed")
+			}
+		})
+	}
+
+	// The encoder of a failed response is returned to the pool and still works.
+	handler := Compress(nil)(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(large))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if got := decodeBody(t, ENCODING_GZIP, w.Body.Bytes()); got != large {
+		t.Errorf("decoded body after a panic = %q", got)
+	}
+}
@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// DecompressOption defines the configuration options for the request decompression middleware.
+type DecompressOption struct {
+	// Encodings are the supported `Content-Encoding` values of request bodies.
+	Encodings []string
+	// MaxBodySize is the maximum size in bytes of the request body as sent by the client, compressed or not.
+	// Zero or negative disables the limit.
+	MaxBodySize int64
+	// MaxDecompressedSize is the maximum size in bytes of a decompressed request body. It protects against
+	// zip bombs, small bodies that expand to huge ones. Zero or negative disables the limit.
+	MaxDecompressedSize int64
+}
+
+// DefaultDecompressMiddlewareOption provides default values for request decompression options.
+var DefaultDecompressMiddlewareOption = DecompressOption{
+	Encodings:           []string{ENCODING_ZSTD, ENCODING_GZIP, ENCODING_DEFLATE},
+	MaxBodySize:         10 << 20, // 10MB
+	MaxDecompressedSize: 50 << 20, // 50MB
+}
+
+// Decompression is a middleware that decompresses request bodies sent with `Content-Encoding`, and limits the size
+// of every request body.
+//
+// A compressed body is decoded before calling the next handler, so `r.Body`, `r.ContentLength` and the
+// `Content-Length` header describe the plain body, and `Content-Encoding` is removed. Handlers, extensions.Bind,
+// extensions.ValidationMiddleware and extensions.Metrics then see the body as if it was sent uncompressed.
+// Bodies without `Content-Encoding` are streamed as is, with reads failing past MaxBodySize.
+//
+// Bodies over a limit are rejected with 413, unsupported encodings with 415 and an `Accept-Encoding` header
+// listing the supported ones, and corrupt compressed data with 400.
+type Decompression struct {
+	*DecompressOption
+	zstd sync.Pool
+}
+
+// NewDecompressMiddleware creates a new request decompression middleware. if option is nil, it uses the default options.
+func NewDecompressMiddleware(option *DecompressOption) *Decompression {
+	if option == nil {
+		option = &DefaultDecompressMiddlewareOption
+	}
+
+	d := &Decompression{
+		DecompressOption: option,
+	}
+
+	d.zstd.New = func() any {
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true)}
+		if option.MaxDecompressedSize > 0 {
+			options = append(options, zstd.WithDecoderMaxMemory(uint64(option.MaxDecompressedSize)))
+		}
+
+		decoder, _ := zstd.NewReader(nil, options...)
+		return decoder
+	}
+
+	return d
+}
+
+// Decompress returns a request decompression middleware with the given options. if option is nil, it uses the default options.
+func Decompress(option *DecompressOption) func(http.HandlerFunc) http.HandlerFunc {
+	return NewDecompressMiddleware(option).Middleware
+}
+
+// Middleware returns an HTTP middleware function that decompresses and limits the request body.
+func (d *Decompression) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next(w, r)
+			return
+		}
+
+		if d.MaxBodySize > 0 {
+			if r.ContentLength > d.MaxBodySize {
+				panic(bodyTooLargeError(d.MaxBodySize))
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, d.MaxBodySize)
+		}
+
+		encodings := d.contentEncodings(r)
+		if len(encodings) == 0 {
+			next(w, r)
+			return
+		}
+
+		for _, encoding := range encodings {
+			if !d.supports(encoding) {
+				w.Header().Set("Accept-Encoding", strings.Join(d.Encodings, ", "))
+				panic(extensions.ValidationError{
+					Message: "Unsupported content encoding",
+					Code:    http.StatusUnsupportedMediaType,
+					Fields: map[string]any{
+						"Content-Encoding": strconv.Quote(encoding) + " is not supported",
+					},
+				})
+			}
+		}
+
+		body, err := d.decode(r.Body, encodings)
+		r.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Encoding")
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+		next(w, r)
+	}
+}
+
+// contentEncodings returns the encodings of the request body in the order they were applied, without `identity`.
+func (d *Decompression) contentEncodings(r *http.Request) []string {
+	var encodings []string
+	for _, part := range strings.Split(strings.Join(r.Header.Values("Content-Encoding"), ","), ",") {
+		encoding := strings.ToLower(strings.TrimSpace(part))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		if encoding == "x-gzip" {
+			encoding = ENCODING_GZIP
+		}
+
+		encodings = append(encodings, encoding)
+	}
+
+	return encodings
+}
+
+func (d *Decompression) supports(encoding string) bool {
+	for _, supported := range d.Encodings {
+		if encoding == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decode reads the body, undoing the encodings from the last applied to the first, and returns the plain body.
+func (d *Decompression) decode(body io.Reader, encodings []string) ([]byte, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, d.decodeError(err)
+	}
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		if data, err = d.decodeOne(data, encodings[i]); err != nil {
+			return nil, d.decodeError(err)
+		}
+	}
+
+	return data, nil
+}
+
+// decodeOne decodes the data with the encoding, failing with *http.MaxBytesError past MaxDecompressedSize.
+func (d *Decompression) decodeOne(data []byte, encoding string) ([]byte, error) {
+	var reader io.Reader
+	switch encoding {
+	case ENCODING_GZIP:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		reader = gz
+	case ENCODING_DEFLATE:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		reader = zr
+	case ENCODING_ZSTD:
+		decoder := d.zstd.Get().(*zstd.Decoder)
+		defer func() {
+			decoder.Reset(nil)
+			d.zstd.Put(decoder)
+		}()
+
+		if err := decoder.Reset(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+
+		reader = decoder
+	default:
+		return nil, errors.New("unsupported content encoding " + strconv.Quote(encoding))
+	}
+
+	if d.MaxDecompressedSize <= 0 {
+		return io.ReadAll(reader)
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, d.MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(decoded)) > d.MaxDecompressedSize {
+		return nil, &http.MaxBytesError{Limit: d.MaxDecompressedSize}
+	}
+
+	return decoded, nil
+}
+
+// decodeError converts a read or decoding error into a ValidationError.
+func (d *Decompression) decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return bodyTooLargeError(maxBytesErr.Limit)
+	}
+
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return bodyTooLargeError(d.MaxDecompressedSize)
+	}
+
+	return extensions.ValidationError{
+		Message: "Invalid request body",
+		Code:    http.StatusBadRequest,
+		Fields: map[string]any{
+			"body": err.Error(),
+		},
+	}
+}
+
+func bodyTooLargeError(limit int64) extensions.ValidationError {
+	return extensions.ValidationError{
+		Message: "Request body too large",
+		Code:    http.StatusRequestEntityTooLarge,
+		Fields: map[string]any{
+			"body": "must not exceed " + strconv.FormatInt(limit, 10) + " bytes",
+		},
+	}
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func encodeBody(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case ENCODING_GZIP:
+		w = gzip.NewWriter(&buf)
+	case ENCODING_DEFLATE:
+		w = zlib.NewWriter(&buf)
+	case ENCODING_ZSTD:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+
+	w.Write(data)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	plain := []byte(`{"name":"` + strings.Repeat("gopher", 100) + `"}`)
+
+	gzipped := encodeBody(t, ENCODING_GZIP, plain)
+	stacked := encodeBody(t, ENCODING_ZSTD, gzipped)
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		wantCode        int
+	}{
+		{"plain", "", plain, 0},
+		{"identity", "identity", plain, 0},
+		{"gzip", "gzip", gzipped, 0},
+		{"x-gzip", "x-gzip", gzipped, 0},
+		{"deflate", "deflate", encodeBody(t, ENCODING_DEFLATE, plain), 0},
+		{"zstd", "zstd", encodeBody(t, ENCODING_ZSTD, plain), 0},
+		{"stacked encodings", "gzip, zstd", stacked, 0},
+		{"unsupported encoding", "br", plain, http.StatusUnsupportedMediaType},
+		{"corrupt data", "gzip", []byte("not gzip at all"), http.StatusBadRequest},
+		{"truncated data", "gzip", gzipped[:len(gzipped)/2], http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			handler := recoverErrors(Decompress(nil)(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentEncoding != "identity" && r.Header.Get("Content-Encoding") != "" {
+					t.Errorf("Content-Encoding = %q after decompression", r.Header.Get("Content-Encoding"))
+				}
+
+				if tt.contentEncoding != "" && tt.contentEncoding != "identity" && r.ContentLength != int64(len(plain)) {
+					t.Errorf("ContentLength = %d, want the plain size %d", r.ContentLength, len(plain))
+				}
+
+				got, _ = io.ReadAll(r.Body)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if tt.wantCode != 0 {
+				if w.Code != tt.wantCode {
+					t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+				}
+
+				if tt.wantCode == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Encoding") != "zstd, gzip, deflate" {
+					t.Errorf("Accept-Encoding = %q, want the supported encodings", w.Header().Get("Accept-Encoding"))
+				}
+				return
+			}
+
+			if !bytes.Equal(got, plain) {
+				t.Errorf("body = %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	option := &DecompressOption{
+		Encodings:           []string{ENCODING_GZIP, ENCODING_ZSTD},
+		MaxBodySize:         4096,
+		MaxDecompressedSize: 16384,
+	}
+
+	bomb := bytes.Repeat([]byte("a"), 1<<20)
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		contentLength   int64
+	}{
+		{"declared size", "", make([]byte, 8192), 8192},
+		{"compressed size", "gzip", make([]byte, 8192), -1},
+		{"gzip bomb", "gzip", encodeBody(t, ENCODING_GZIP, bomb), 0},
+		{"zstd bomb", "zstd", encodeBody(t, ENCODING_ZSTD, bomb), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.contentEncoding != "" && tt.contentLength == 0 && int64(len(tt.body)) > option.MaxBodySize {
+				t.Fatalf("the compressed bomb is %d bytes, want it below MaxBodySize", len(tt.body))
+			}
+
+			called := false
+			handler := recoverErrors(Decompress(option)(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.contentLength != 0 {
+				r.ContentLength = tt.contentLength
+			}
+			if tt.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != http.StatusRequestEntityTooLarge || called {
+				t.Errorf("status = %d, next called = %v, want 413 before the handler", w.Code, called)
+			}
+		})
+	}
+
+	// Plain bodies are streamed, so the handler sees the limit as a read error.
+	var readErr error
+	handler := Decompress(option)(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, 8192)))
+	r.ContentLength = -1
+	handler(httptest.NewRecorder(), r)
+
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(readErr, &maxBytesErr) || maxBytesErr.Limit != option.MaxBodySize {
+		t.Errorf("read error = %v, want a MaxBytesError of %d bytes", readErr, option.MaxBodySize)
+	}
+}
@@ -0,0 +1,282 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+// OpenAPIOption defines the configuration options for the OpenAPI validation middleware.
+type OpenAPIOption struct {
+	// ValidateResponse validates the responses against the spec as well. Responses are buffered, so only enable it in development.
+	// Streamed responses, flushed by the handler, are already sent to the client, so they are not validated.
+	ValidateResponse bool
+	// SkipUnknownRoutes passes requests that don't match any operation of the spec to the next handler instead of rejecting them.
+	SkipUnknownRoutes bool
+	// Authenticate checks the security requirements of the operations.
+	// If nil, requests to operations with security requirements are rejected.
+	Authenticate openapi3filter.AuthenticationFunc
+}
+
+// DefaultOpenAPIMiddlewareOption provides default values for OpenAPI validation options.
+var DefaultOpenAPIMiddlewareOption = OpenAPIOption{
+	ValidateResponse:  false,
+	SkipUnknownRoutes: false,
+	Authenticate:      nil,
+}
+
+// OpenAPI is a middleware that validates requests, and optionally responses, against an OpenAPI spec.
+// Validation failures are raised as extensions.ValidationError, so they are formatted by the server's ErrorHandler.
+// Requests are matched on their path only, so the servers of the spec only contribute their base path.
+type OpenAPI struct {
+	*OpenAPIOption
+	router routers.Router
+}
+
+// NewOpenAPIMiddleware creates a new OpenAPI validation middleware for the given spec. if option is nil, it uses the default options.
+func NewOpenAPIMiddleware(spec *openapi3.T, option *OpenAPIOption) (*OpenAPI, error) {
+	if spec == nil {
+		return nil, errors.New("spec cannot be nil")
+	}
+
+	if option == nil {
+		option = &DefaultOpenAPIMiddlewareOption
+	}
+
+	router, err := legacy.NewRouter(pathOnlySpec(spec))
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAPI{
+		OpenAPIOption: option,
+		router:        router,
+	}, nil
+}
+
+// pathOnlySpec returns a shallow copy of the spec whose servers only keep their path, e.g. `/v1` for
+// `https://api.example.com/v1`, because the requests received by the server only carry their path.
+func pathOnlySpec(spec *openapi3.T) *openapi3.T {
+	if len(spec.Servers) == 0 {
+		return spec
+	}
+
+	copied := *spec
+	copied.Servers = make(openapi3.Servers, 0, len(spec.Servers))
+	for _, server := range spec.Servers {
+		if server == nil {
+			continue
+		}
+
+		path := *server
+		path.URL = serverPath(server.URL)
+		copied.Servers = append(copied.Servers, &path)
+	}
+
+	return &copied
+}
+
+// serverPath returns the path of a server URL, keeping its variables, e.g. `/{version}` for `https://{host}/{version}`.
+func serverPath(url string) string {
+	if _, rest, ok := strings.Cut(url, "://"); ok {
+		url = "/"
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			url = rest[i:]
+		}
+	}
+
+	if !strings.HasPrefix(url, "/") {
+		url = "/" + url
+	}
+
+	return url
+}
+
+// Middleware returns an HTTP middleware function that validates the request against the spec.
+func (o *OpenAPI) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := o.router.FindRoute(r)
+		if err != nil {
+			if o.SkipUnknownRoutes {
+				next(w, r)
+				return
+			}
+
+			panic(openAPIValidationError(err, "Request does not match the API specification", http.StatusBadRequest))
+		}
+
+		options := &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: o.Authenticate,
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			panic(openAPIValidationError(err, "Request does not match the API specification", http.StatusBadRequest))
+		}
+
+		if !o.ValidateResponse {
+			next(w, r)
+			return
+		}
+
+		wrapped := extensions.NewCustomResponseWriter(w)
+		next(wrapped, r)
+
+		if wrapped.Flushed() {
+			wrapped.Flush()
+			return
+		}
+
+		response := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 wrapped.StatusCode,
+			Header:                 wrapped.Header(),
+			Options:                options,
+		}
+		response.SetBodyBytes(wrapped.Body.Bytes())
+
+		if err := openapi3filter.ValidateResponse(r.Context(), response); err != nil {
+			panic(openAPIValidationError(err, "Response does not match the API specification", http.StatusInternalServerError))
+		}
+
+		wrapped.Flush()
+	}
+}
+
+// OpenAPIValidator returns a middleware that validates requests against the spec with the default options.
+// It panics if the spec is invalid.
+func OpenAPIValidator(spec *openapi3.T) func(http.HandlerFunc) http.HandlerFunc {
+	o, err := NewOpenAPIMiddleware(spec, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return o.Middleware
+}
+
+// flattenOpenAPIErrors splits the multi errors returned by openapi3filter, keeping the request or response context of each error.
+func flattenOpenAPIErrors(err error) []error {
+	errs := []error{}
+
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, inner := range e {
+			errs = append(errs, flattenOpenAPIErrors(inner)...)
+		}
+
+		return errs
+	case *openapi3filter.RequestError:
+		if multi, ok := e.Err.(openapi3.MultiError); ok {
+			for _, inner := range multi {
+				requestErr := *e
+				requestErr.Err = inner
+				errs = append(errs, flattenOpenAPIErrors(&requestErr)...)
+			}
+
+			return errs
+		}
+	case *openapi3filter.ResponseError:
+		if multi, ok := e.Err.(openapi3.MultiError); ok {
+			for _, inner := range multi {
+				responseErr := *e
+				responseErr.Err = inner
+				errs = append(errs, flattenOpenAPIErrors(&responseErr)...)
+			}
+
+			return errs
+		}
+	}
+
+	return append(errs, err)
+}
+
+// openAPIValidationError converts the errors returned by openapi3filter into a ValidationError with one entry per field.
+// Fields are keyed by parameter name, or by the dotted path of the body property.
+func openAPIValidationError(err error, message string, code int) extensions.ValidationError {
+	validationErr := extensions.ValidationError{
+		Message: message,
+		Code:    code,
+		Fields:  make(map[string]any),
+	}
+
+	for i, err := range flattenOpenAPIErrors(err) {
+		var securityErr *openapi3filter.SecurityRequirementsError
+		if errors.As(err, &securityErr) {
+			return extensions.ValidationError{
+				Message: http.StatusText(http.StatusUnauthorized),
+				Code:    http.StatusUnauthorized,
+			}
+		}
+
+		var routeErr *routers.RouteError
+		if errors.As(err, &routeErr) {
+			converted := openapi3filter.ConvertErrors(routeErr).(*openapi3filter.ValidationError)
+			return extensions.ValidationError{
+				Message: converted.Title,
+				Code:    converted.Status,
+			}
+		}
+
+		var responseErr *openapi3filter.ResponseError
+		if errors.As(err, &responseErr) {
+			field := "body"
+			var schemaErr *openapi3.SchemaError
+			if errors.As(responseErr, &schemaErr) {
+				if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+					field = strings.Join(pointer, ".")
+				}
+
+				validationErr.Fields[field] = schemaErr.Reason
+				continue
+			}
+
+			validationErr.Fields[field] = responseErr.Error()
+			continue
+		}
+
+		cErr, ok := openapi3filter.ConvertErrors(err).(*openapi3filter.ValidationError)
+		if !ok {
+			validationErr.Fields[fmt.Sprintf("error_%d", i)] = err.Error()
+			continue
+		}
+
+		if cErr.Status == http.StatusNotFound || cErr.Status == http.StatusUnsupportedMediaType {
+			validationErr.Code = cErr.Status
+		}
+
+		field := "body"
+		if cErr.Source != nil && cErr.Source.Parameter != "" {
+			field = cErr.Source.Parameter
+		} else if cErr.Source != nil && strings.Trim(cErr.Source.Pointer, "/") != "" {
+			field = strings.ReplaceAll(strings.Trim(cErr.Source.Pointer, "/"), "/", ".")
+		} else {
+			var requestErr *openapi3filter.RequestError
+			if errors.As(err, &requestErr) && requestErr.Parameter != nil {
+				field = requestErr.Parameter.Name
+			}
+		}
+
+		reason := cErr.Title
+		if cErr.Detail != "" {
+			reason = cErr.Detail
+		}
+
+		validationErr.Fields[field] = reason
+	}
+
+	return validationErr
+}
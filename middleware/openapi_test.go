@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+const testSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "test", "version": "1.0.0"},
+  "servers": [{"url": "https://api.example.com/v1"}],
+  "paths": {
+    "/users/{id}": {
+      "post": {
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "required": ["name"],
+            "properties": {"name": {"type": "string", "minLength": 2}}
+          }}}
+        },
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {"application/json": {"schema": {
+              "type": "object",
+              "required": ["id"],
+              "properties": {"id": {"type": "integer"}}
+            }}}
+          }
+        }
+      }
+    }
+  }
+}`
+
+func loadTestSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	spec, err := openapi3.NewLoader().LoadFromData([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("LoadFromData: %v", err)
+	}
+
+	return spec
+}
+
+// serveRecovered serves the request and returns the ValidationError raised by the handler, if any.
+func serveRecovered(t *testing.T, h http.HandlerFunc, r *http.Request) (w *httptest.ResponseRecorder, validationErr *extensions.ValidationError) {
+	t.Helper()
+
+	w = httptest.NewRecorder()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err, ok := recovered.(extensions.ValidationError)
+			if !ok {
+				t.Fatalf("panic = %v, want a ValidationError", recovered)
+			}
+
+			validationErr = &err
+		}
+	}()
+
+	h(w, r)
+	return w, nil
+}
+
+func TestOpenAPIRequestValidation(t *testing.T) {
+	o, err := NewOpenAPIMiddleware(loadTestSpec(t), &OpenAPIOption{})
+	if err != nil {
+		t.Fatalf("NewOpenAPIMiddleware: %v", err)
+	}
+
+	handler := o.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		wantCode  int
+		wantField string
+	}{
+		{"valid under the server base path", "/v1/users/42", `{"name":"gopher"}`, 0, ""},
+		{"invalid body", "/v1/users/42", `{"name":"g"}`, http.StatusBadRequest, "name"},
+		{"missing property", "/v1/users/42", `{}`, http.StatusBadRequest, "name"},
+		{"invalid path parameter", "/v1/users/abc", `{"name":"gopher"}`, http.StatusNotFound, "id"},
+		{"path outside the base path", "/users/42", `{"name":"gopher"}`, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			w, validationErr := serveRecovered(t, handler, r)
+			if tt.wantCode == 0 {
+				if validationErr != nil {
+					t.Fatalf("request rejected with %+v", *validationErr)
+				}
+
+				if w.Code != http.StatusOK {
+					t.Errorf("status = %d, want 200", w.Code)
+				}
+				return
+			}
+
+			if validationErr == nil || validationErr.Code != tt.wantCode {
+				t.Fatalf("ValidationError = %#v, want code %d", validationErr, tt.wantCode)
+			}
+
+			if _, ok := validationErr.Fields[tt.wantField]; tt.wantField != "" && !ok {
+				t.Errorf("fields = %v, want %q", validationErr.Fields, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestOpenAPISkipUnknownRoutes(t *testing.T) {
+	o, err := NewOpenAPIMiddleware(loadTestSpec(t), &OpenAPIOption{SkipUnknownRoutes: true})
+	if err != nil {
+		t.Fatalf("NewOpenAPIMiddleware: %v", err)
+	}
+
+	called := false
+	handler := o.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	if _, validationErr := serveRecovered(t, handler, httptest.NewRequest(http.MethodGet, "/health", nil)); validationErr != nil || !called {
+		t.Errorf("unknown route: ValidationError = %v, next called = %v, want it passed to next", validationErr, called)
+	}
+}
+
+func TestOpenAPIResponseValidation(t *testing.T) {
+	o, err := NewOpenAPIMiddleware(loadTestSpec(t), &OpenAPIOption{ValidateResponse: true})
+	if err != nil {
+		t.Fatalf("NewOpenAPIMiddleware: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{"valid", `{"id":42}`, false},
+		{"invalid", `{"id":"42"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := o.Middleware(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.response))
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/users/42", strings.NewReader(`{"name":"gopher"}`))
+			r.Header.Set("Content-Type", "application/json")
+
+			w, validationErr := serveRecovered(t, handler, r)
+			if tt.wantErr {
+				if validationErr == nil || validationErr.Code != http.StatusInternalServerError {
+					t.Fatalf("ValidationError = %+v, want code 500", validationErr)
+				}
+
+				if w.Body.Len() > 0 {
+					t.Errorf("invalid response was sent: %q", w.Body.String())
+				}
+				return
+			}
+
+			if validationErr != nil || w.Body.String() != tt.response {
+				t.Errorf("response = %q, %v, want %q", w.Body.String(), validationErr, tt.response)
+			}
+		})
+	}
+}
+
+func TestOpenAPIStreamedResponse(t *testing.T) {
+	o, err := NewOpenAPIMiddleware(loadTestSpec(t), &OpenAPIOption{ValidateResponse: true})
+	if err != nil {
+		t.Fatalf("NewOpenAPIMiddleware: %v", err)
+	}
+
+	handler := o.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":`))
+		http.NewResponseController(w).Flush()
+		w.Write([]byte(`42}`))
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/users/42", strings.NewReader(`{"name":"gopher"}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	// The tail alone isn't a valid response, so validating it would reject the streamed response.
+	w, validationErr := serveRecovered(t, handler, r)
+	if validationErr != nil || w.Body.String() != `{"id":42}` {
+		t.Errorf("response = %q, %v, want the whole streamed body", w.Body.String(), validationErr)
+	}
+}
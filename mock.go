@@ -0,0 +1,487 @@
+package mahakam
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/seiortech/mahakam/middleware"
+)
+
+const (
+	HEADER_PREFER      = "Prefer"        // Prefer selects the mocked response, e.g. `Prefer: code=404, example=notFound, dynamic=true`.
+	HEADER_MOCK_STATUS = "X-Mock-Status" // X-Mock-Status selects the status code of the mocked response.
+)
+
+// MOCK_MAX_DEPTH limits the depth of the data generated for recursive schemas.
+const MOCK_MAX_DEPTH = 8
+
+var mockPathSegmentPattern = regexp.MustCompile(`^\{[A-Za-z_][A-Za-z0-9_]*\}$`)
+
+// mockPreference holds the response selection of a mocked request.
+type mockPreference struct {
+	code    string
+	example string
+	dynamic bool
+}
+
+func newMockPreference(r *http.Request) mockPreference {
+	p := mockPreference{}
+
+	for _, value := range r.Header.Values(HEADER_PREFER) {
+		for _, pref := range strings.Split(value, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "code", "status":
+				p.code = val
+			case "example":
+				p.example = val
+			case "dynamic":
+				p.dynamic = val == "" || val == "true"
+			}
+		}
+	}
+
+	if status := r.Header.Get(HEADER_MOCK_STATUS); status != "" {
+		p.code = status
+	}
+
+	return p
+}
+
+// mockPattern converts an OpenAPI path to a ServeMux pattern. Segments that are not a single path parameter,
+// like `{id}.json`, are matched by an anonymous wildcard.
+func mockPattern(method, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.Contains(segment, "{") && !mockPathSegmentPattern.MatchString(segment) {
+			segments[i] = fmt.Sprintf("{segment%d}", i)
+		}
+	}
+
+	path = strings.Join(segments, "/")
+	if strings.HasSuffix(path, "/") {
+		path += "{$}"
+	}
+
+	return strings.ToUpper(method) + " " + path
+}
+
+// mockStatus returns the status code of a response key, e.g. 404 for `404` and 400 for the `4XX` range.
+func mockStatus(key string) (int, bool) {
+	if len(key) != 3 {
+		return 0, false
+	}
+
+	if strings.EqualFold(key[1:], "XX") {
+		key = key[:1] + "00"
+	}
+
+	status, err := strconv.Atoi(key)
+	if err != nil || status < 100 || status > 599 {
+		return 0, false
+	}
+
+	return status, true
+}
+
+// mockResponse selects the documented response of the operation for the requested status, looking up the exact
+// status, then its range like `4XX`, then the default response. Without a requested status, it falls back to the
+// lowest 2xx response, then the default response, then the lowest documented response.
+func mockResponse(op *openapi3.Operation, code string) (int, *openapi3.Response) {
+	if op.Responses == nil {
+		return http.StatusOK, nil
+	}
+
+	codes := make([]string, 0, op.Responses.Len())
+	for key := range op.Responses.Map() {
+		codes = append(codes, key)
+	}
+	sort.Strings(codes)
+
+	if status, ok := mockStatus(code); ok && !strings.EqualFold(code[1:], "XX") {
+		for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+			if ref := op.Responses.Value(key); ref != nil && ref.Value != nil {
+				return status, ref.Value
+			}
+		}
+	}
+
+	for _, key := range codes {
+		if status, ok := mockStatus(key); ok && status/100 == 2 {
+			if ref := op.Responses.Value(key); ref != nil && ref.Value != nil {
+				return status, ref.Value
+			}
+		}
+	}
+
+	if ref := op.Responses.Default(); ref != nil && ref.Value != nil {
+		return http.StatusOK, ref.Value
+	}
+
+	for _, key := range codes {
+		if status, ok := mockStatus(key); ok {
+			if ref := op.Responses.Value(key); ref != nil && ref.Value != nil {
+				return status, ref.Value
+			}
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// mockMediaType picks the content type of the response that matches the `Accept` header, preferring JSON.
+func mockMediaType(r *http.Request, content openapi3.Content) (string, *openapi3.MediaType) {
+	if len(content) == 0 {
+		return "", nil
+	}
+
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		ji, jj := strings.Contains(types[i], "json"), strings.Contains(types[j], "json")
+		if ji != jj {
+			return ji
+		}
+
+		return types[i] < types[j]
+	})
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		accept, _, _ = strings.Cut(strings.TrimSpace(accept), ";")
+		if accept == "" || accept == "*/*" {
+			continue
+		}
+
+		for _, mediaType := range types {
+			if accept == mediaType || (strings.HasSuffix(accept, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(accept, "*"))) {
+				return mediaType, content[mediaType]
+			}
+		}
+	}
+
+	return types[0], content[types[0]]
+}
+
+// mockExample returns the documented example of the media type, or data generated from its schema.
+func mockExample(mediaType *openapi3.MediaType, p mockPreference) any {
+	if p.example != "" {
+		if ref := mediaType.Examples[p.example]; ref != nil && ref.Value != nil {
+			return ref.Value.Value
+		}
+	}
+
+	if !p.dynamic {
+		if mediaType.Example != nil {
+			return mediaType.Example
+		}
+
+		names := make([]string, 0, len(mediaType.Examples))
+		for name := range mediaType.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if ref := mediaType.Examples[name]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+				return ref.Value.Value
+			}
+		}
+	}
+
+	if mediaType.Schema == nil {
+		return nil
+	}
+
+	return mockValue(mediaType.Schema.Value, p.dynamic, 0)
+}
+
+// mockValue generates data that matches the schema. Static data is used unless dynamic is set.
+func mockValue(schema *openapi3.Schema, dynamic bool, depth int) any {
+	if schema == nil || depth > MOCK_MAX_DEPTH {
+		return nil
+	}
+
+	if !dynamic && schema.Example != nil {
+		return schema.Example
+	}
+
+	if schema.Default != nil {
+		return schema.Default
+	}
+
+	if len(schema.Enum) > 0 {
+		if dynamic {
+			return schema.Enum[rand.IntN(len(schema.Enum))]
+		}
+
+		return schema.Enum[0]
+	}
+
+	if len(schema.AllOf) > 0 {
+		object := map[string]any{}
+		for _, ref := range schema.AllOf {
+			if value, ok := mockValue(ref.Value, dynamic, depth+1).(map[string]any); ok {
+				for k, v := range value {
+					object[k] = v
+				}
+			}
+		}
+
+		return object
+	}
+
+	if len(schema.OneOf) > 0 {
+		return mockValue(schema.OneOf[0].Value, dynamic, depth+1)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		return mockValue(schema.AnyOf[0].Value, dynamic, depth+1)
+	}
+
+	switch {
+	case schema.Type.Is(openapi3.TypeString):
+		return mockString(schema, dynamic)
+	case schema.Type.Is(openapi3.TypeInteger):
+		min, max := mockRange(schema, 0, 100)
+		if dynamic {
+			return int64(min) + rand.Int64N(int64(max-min)+1)
+		}
+
+		return int64(min)
+	case schema.Type.Is(openapi3.TypeNumber):
+		min, max := mockRange(schema, 0, 100)
+		if dynamic {
+			return min + rand.Float64()*(max-min)
+		}
+
+		return min
+	case schema.Type.Is(openapi3.TypeBoolean):
+		if dynamic {
+			return rand.IntN(2) == 1
+		}
+
+		return true
+	case schema.Type.Is(openapi3.TypeArray):
+		n := int(schema.MinItems)
+		if n == 0 {
+			n = 1
+		}
+
+		items := make([]any, 0, n)
+		if schema.Items != nil {
+			for i := 0; i < n; i++ {
+				items = append(items, mockValue(schema.Items.Value, dynamic, depth+1))
+			}
+		}
+
+		return items
+	case schema.Type.Is(openapi3.TypeObject) || len(schema.Properties) > 0:
+		object := make(map[string]any, len(schema.Properties))
+		for name, ref := range schema.Properties {
+			if ref.Value != nil && ref.Value.WriteOnly {
+				continue
+			}
+
+			object[name] = mockValue(ref.Value, dynamic, depth+1)
+		}
+
+		return object
+	}
+
+	return nil
+}
+
+func mockRange(schema *openapi3.Schema, min, max float64) (float64, float64) {
+	if schema.Min != nil {
+		min = *schema.Min
+		if schema.ExclusiveMin {
+			min++
+		}
+	}
+
+	if schema.Max != nil {
+		max = *schema.Max
+		if schema.ExclusiveMax {
+			max--
+		}
+	} else if max < min {
+		max = min + 100
+	}
+
+	if max < min {
+		max = min
+	}
+
+	return min, max
+}
+
+func mockString(schema *openapi3.Schema, dynamic bool) string {
+	switch schema.Format {
+	case "date-time":
+		return time.Now().UTC().Format(time.RFC3339)
+	case "date":
+		return time.Now().UTC().Format(time.DateOnly)
+	case "time":
+		return time.Now().UTC().Format(time.TimeOnly)
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		if dynamic {
+			return fmt.Sprintf("%08x-%04x-4%03x-8%03x-%012x", rand.Uint32(), rand.Uint32()&0xffff, rand.Uint32()&0xfff, rand.Uint32()&0xfff, rand.Uint64()&0xffffffffffff)
+		}
+
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "byte":
+		return "c3RyaW5n"
+	}
+
+	value := "string"
+	if dynamic {
+		const letters = "abcdefghijklmnopqrstuvwxyz"
+		b := make([]byte, 8)
+		for i := range b {
+			b[i] = letters[rand.IntN(len(letters))]
+		}
+		value = string(b)
+	}
+
+	for uint64(len(value)) < schema.MinLength {
+		value += value
+	}
+
+	if schema.MaxLength != nil && uint64(len(value)) > *schema.MaxLength {
+		value = value[:*schema.MaxLength]
+	}
+
+	return value
+}
+
+// mockHandler answers the requests of an operation with the documented examples or data generated from the schemas.
+func mockHandler(op *openapi3.Operation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newMockPreference(r)
+		status, response := mockResponse(op, p.code)
+
+		if response == nil {
+			w.WriteHeader(status)
+			return
+		}
+
+		for name, ref := range response.Headers {
+			if ref.Value == nil || ref.Value.Schema == nil {
+				continue
+			}
+
+			value := ref.Value.Example
+			if value == nil {
+				value = mockValue(ref.Value.Schema.Value, p.dynamic, 0)
+			}
+
+			if value != nil {
+				w.Header().Set(name, fmt.Sprint(value))
+			}
+		}
+
+		contentType, mediaType := mockMediaType(r, response.Content)
+		if mediaType == nil {
+			w.WriteHeader(status)
+			return
+		}
+
+		var body []byte
+		value := mockExample(mediaType, p)
+		if s, ok := value.(string); ok && !strings.Contains(contentType, "json") {
+			body = []byte(s)
+		} else {
+			var err error
+			if body, err = json.Marshal(value); err != nil {
+				panic(err)
+			}
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+// mockBasePaths returns the distinct base paths of the servers of the document, without their trailing slash.
+func mockBasePaths(doc *openapi3.T) ([]string, error) {
+	if len(doc.Servers) == 0 {
+		return []string{""}, nil
+	}
+
+	bases := []string{}
+	seen := make(map[string]bool)
+	for _, server := range doc.Servers {
+		base, err := server.BasePath()
+		if err != nil {
+			return nil, fmt.Errorf("invalid server url %q: %w", server.URL, err)
+		}
+
+		base = strings.TrimSuffix(base, "/")
+		if !seen[base] {
+			seen[base] = true
+			bases = append(bases, base)
+		}
+	}
+
+	return bases, nil
+}
+
+// Mock registers every operation of the OpenAPI document on the server. Each operation answers with its documented
+// examples, or with data generated from the response schemas. The response can be selected with the `Prefer` header
+// (`code=404`, `example=name`, `dynamic=true`) or the `X-Mock-Status` header. Requests are validated against the document.
+// Operations are registered under the base path of every server of the document, e.g. `/v1/users` for `/v1`.
+func (s *Server) Mock(doc *openapi3.T) (err error) {
+	validator, err := middleware.NewOpenAPIMiddleware(doc, &middleware.OpenAPIOption{
+		Authenticate: openapi3filter.NoopAuthenticationFunc,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("failed to register mock operation: %v", recovered)
+		}
+	}()
+
+	bases, err := mockBasePaths(doc)
+	if err != nil {
+		return err
+	}
+
+	paths := doc.Paths.InMatchingOrder()
+	for _, base := range bases {
+		for _, path := range paths {
+			item := doc.Paths.Value(path)
+			for method, op := range item.Operations() {
+				s.HandleFunc(mockPattern(method, base+path), mockHandler(op), validator.Middleware)
+			}
+		}
+	}
+
+	return nil
+}
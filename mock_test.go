@@ -0,0 +1,197 @@
+package mahakam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+const testMockSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "pets", "version": "1.0.0"},
+  "servers": [{"url": "https://api.example.com/v1"}, {"url": "https://staging.example.com/v1/"}],
+  "paths": {
+    "/pets/{id}": {
+      "get": {
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {"application/json": {
+              "schema": {"$ref": "#/components/schemas/Pet"},
+              "examples": {
+                "rex": {"value": {"id": 1, "name": "rex"}},
+                "tom": {"value": {"id": 2, "name": "tom"}}
+              }
+            }}
+          },
+          "4XX": {
+            "description": "Client error",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+          },
+          "default": {
+            "description": "Error",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+          }
+        }
+      }
+    },
+    "/pets": {
+      "get": {
+        "responses": {
+          "200": {
+            "description": "OK",
+            "headers": {"X-Total": {"schema": {"type": "integer", "example": 3}}},
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}}
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Pet": {
+        "type": "object",
+        "required": ["id", "name"],
+        "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+      },
+      "Error": {
+        "type": "object",
+        "properties": {"message": {"type": "string"}}
+      }
+    }
+  }
+}`
+
+func TestMock(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(testMockSpec))
+	if err != nil {
+		t.Fatalf("LoadFromData: %v", err)
+	}
+
+	s := NewServer("", http.NewServeMux())
+	if err := s.Mock(doc); err != nil {
+		t.Fatalf("Mock: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		header     http.Header
+		wantStatus int
+		wantBody   string
+		wantKeys   []string
+	}{
+		{"first named example", "/v1/pets/1", nil, http.StatusOK, `{"id":1,"name":"rex"}`, nil},
+		{"selected example", "/v1/pets/1", http.Header{HEADER_PREFER: {"example=tom"}}, http.StatusOK, `{"id":2,"name":"tom"}`, nil},
+		{"dynamic data", "/v1/pets/1", http.Header{HEADER_PREFER: {"dynamic=true"}}, http.StatusOK, "", []string{"id", "name"}},
+		{"range response", "/v1/pets/1", http.Header{HEADER_PREFER: {"code=404"}}, http.StatusNotFound, "", []string{"message"}},
+		{"default response", "/v1/pets/1", http.Header{HEADER_MOCK_STATUS: {"503"}}, http.StatusServiceUnavailable, "", []string{"message"}},
+		{"generated array", "/v1/pets", nil, http.StatusOK, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+
+			s.dispatch(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+
+			var body any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body.String(), err)
+			}
+
+			for _, key := range tt.wantKeys {
+				if object, ok := body.(map[string]any); !ok || object[key] == nil {
+					t.Errorf("body = %s, want the %q property", w.Body.String(), key)
+				}
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	s.dispatch(w, httptest.NewRequest(http.MethodGet, "/v1/pets", nil))
+	if got := w.Header().Get("X-Total"); got != "3" {
+		t.Errorf("X-Total = %q, want the header example 3", got)
+	}
+
+	// The base path of both servers is `/v1`, so the routes are only registered once.
+	if got := len(s.Routes()); got != 2 {
+		t.Errorf("%d routes registered, want 2", got)
+	}
+}
+
+func TestMockValidatesRequests(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(testMockSpec))
+	if err != nil {
+		t.Fatalf("LoadFromData: %v", err)
+	}
+
+	s := NewServer("", http.NewServeMux())
+	if err := s.Mock(doc); err != nil {
+		t.Fatalf("Mock: %v", err)
+	}
+
+	defer func() {
+		if _, ok := recover().(extensions.ValidationError); !ok {
+			t.Error("an invalid path parameter was not rejected with a ValidationError")
+		}
+	}()
+
+	s.dispatch(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/pets/abc", nil))
+}
+
+func TestMockResponse(t *testing.T) {
+	response := func(description string) *openapi3.ResponseRef {
+		return &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription(description)}
+	}
+
+	tests := []struct {
+		name       string
+		responses  map[string]*openapi3.ResponseRef
+		code       string
+		wantStatus int
+		want       string
+	}{
+		{"exact code", map[string]*openapi3.ResponseRef{"200": response("ok"), "404": response("missing")}, "404", http.StatusNotFound, "missing"},
+		{"range", map[string]*openapi3.ResponseRef{"200": response("ok"), "4XX": response("client")}, "409", http.StatusConflict, "client"},
+		{"lowercase range", map[string]*openapi3.ResponseRef{"200": response("ok"), "5xx": response("server")}, "502", http.StatusBadGateway, "server"},
+		{"default for a code", map[string]*openapi3.ResponseRef{"200": response("ok"), "default": response("error")}, "500", http.StatusInternalServerError, "error"},
+		{"lowest 2xx", map[string]*openapi3.ResponseRef{"404": response("missing"), "204": response("empty"), "201": response("created")}, "", http.StatusCreated, "created"},
+		{"undocumented code", map[string]*openapi3.ResponseRef{"200": response("ok")}, "404", http.StatusOK, "ok"},
+		{"default without 2xx", map[string]*openapi3.ResponseRef{"404": response("missing"), "default": response("error")}, "", http.StatusOK, "error"},
+		{"lowest documented", map[string]*openapi3.ResponseRef{"500": response("server"), "4XX": response("client")}, "", http.StatusBadRequest, "client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := openapi3.NewOperation()
+			op.Responses = openapi3.NewResponses()
+			op.Responses.Delete("default")
+			for code, ref := range tt.responses {
+				op.Responses.Set(code, ref)
+			}
+
+			status, got := mockResponse(op, tt.code)
+			if status != tt.wantStatus || got == nil || *got.Description != tt.want {
+				t.Errorf("mockResponse(%q) = %d, %v, want %d, %q", tt.code, status, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 type netpoolFramework struct {
 	Address      string
-	mux          *http.ServeMux
+	handler      http.HandlerFunc
 	middleware   []Middleware
 	ErrorHandler func(http.ResponseWriter, *http.Request, error)
 }
@@ -47,6 +47,14 @@ func (s *netpoolFramework) handleConnection(conn net.Conn) error {
 		return err
 	}
 
+	// Like with net/http, the request context is canceled once the request is served, so the resources tied to it
+	// are released, e.g. the temporary files of the multipart forms read by extensions.Bind.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	w.head = r.Method == http.MethodHead
+
 	defer func() {
 		if recovered := recover(); recovered != nil {
 			if s.ErrorHandler != nil {
@@ -66,7 +74,7 @@ func (s *netpoolFramework) handleConnection(conn net.Conn) error {
 		}
 	}()
 
-	handler := s.mux.ServeHTTP
+	handler := s.handler
 	for i := len(s.middleware) - 1; i >= 0; i-- {
 		handler = s.middleware[i](handler)
 	}
@@ -0,0 +1,340 @@
+package mahakam
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/seiortech/mahakam/extensions"
+	"gopkg.in/yaml.v3"
+)
+
+// OPENAPI_VERSION is the OpenAPI version of the documents generated by the server.
+// The documents are built and validated with kin-openapi, which only models OpenAPI 3.0, so 3.0.3 is emitted
+// instead of 3.1: a 3.1 document would need the JSON Schema 2020-12 keywords that kin-openapi can't represent,
+// and the validator and mock middlewares load their specs with the same library.
+const OPENAPI_VERSION = "3.0.3"
+
+var pathParameterPattern = regexp.MustCompile(`\{([^}.$]+)(\.\.\.)?\}`)
+
+// discardResponseWriter is a response writer that drops everything written to it.
+type discardResponseWriter struct {
+	headers http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	if w.headers == nil {
+		w.headers = make(http.Header)
+	}
+
+	return w.headers
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(statusCode int) {}
+
+// describe asks the route handler and the route middlewares for the Go types they bind and encode.
+// Only the handlers marked with extensions.Describer are called, so plain handlers are never executed.
+// The route middleware factories are called again with a no-op handler to find the describers among them,
+// just like HandleFunc calls them once at registration, so a factory must not have side effects besides
+// building its handler.
+func (route Route) describe() extensions.Description {
+	d := extensions.Description{}
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return d
+	}
+	r = extensions.WithDescription(r, &d)
+
+	for _, m := range route.middleware {
+		if h := m(func(http.ResponseWriter, *http.Request) {}); extensions.IsDescriber(h) {
+			h(&discardResponseWriter{}, r)
+		}
+	}
+
+	if extensions.IsDescriber(route.handler) {
+		route.handler(&discardResponseWriter{}, r)
+	}
+
+	return d
+}
+
+// schemaTag returns the parameter location and name of a struct field bound by extensions.Bind.
+func schemaTag(tag reflect.StructTag) (string, string) {
+	for _, in := range []string{openapi3.ParameterInPath, openapi3.ParameterInQuery, openapi3.ParameterInHeader} {
+		if name := tag.Get(in); name != "" {
+			return in, name
+		}
+	}
+
+	return "", ""
+}
+
+// customizeSchema excludes the parameter fields from body schemas and reads the `description` and `example` struct tags.
+func customizeSchema(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if in, _ := schemaTag(tag); in != "" {
+		return &openapi3gen.ExcludeSchemaSentinel{}
+	}
+
+	if description := tag.Get("description"); description != "" {
+		schema.Description = description
+	}
+
+	if example, ok := tag.Lookup("example"); ok {
+		var value any
+		if err := json.Unmarshal([]byte(example), &value); err != nil {
+			value = example
+		}
+
+		schema.Example = value
+	}
+
+	return nil
+}
+
+// schemaFor generates the schema of a Go type. Component schemas needed for recursive types are added to schemas.
+func schemaFor(t reflect.Type, schemas openapi3.Schemas) (*openapi3.SchemaRef, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() == reflect.Interface {
+		return openapi3.NewSchemaRef("", openapi3.NewSchema()), nil
+	}
+
+	return openapi3gen.NewSchemaRefForValue(
+		reflect.New(t).Elem().Interface(),
+		schemas,
+		openapi3gen.UseAllExportedFields(),
+		openapi3gen.SchemaCustomizer(customizeSchema),
+	)
+}
+
+// parametersFor generates the path, query and header parameters of the struct fields tagged for extensions.Bind.
+func parametersFor(t reflect.Type, schemas openapi3.Schemas) (openapi3.Parameters, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	params := openapi3.NewParameters()
+	if t.Kind() != reflect.Struct {
+		return params, nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			embedded, err := parametersFor(field.Type, schemas)
+			if err != nil {
+				return nil, err
+			}
+
+			params = append(params, embedded...)
+			continue
+		}
+
+		in, name := schemaTag(field.Tag)
+		if in == "" || !field.IsExported() {
+			continue
+		}
+
+		schema, err := schemaFor(field.Type, schemas)
+		if err != nil {
+			return nil, err
+		}
+
+		param := &openapi3.Parameter{
+			Name:        name,
+			In:          in,
+			Required:    in == openapi3.ParameterInPath,
+			Description: field.Tag.Get("description"),
+			Schema:      schema,
+		}
+
+		if example, ok := field.Tag.Lookup("example"); ok {
+			param.Example = example
+		}
+
+		params = append(params, &openapi3.ParameterRef{Value: param})
+	}
+
+	return params, nil
+}
+
+// operation builds the OpenAPI operation of a route.
+func (route Route) operation(schemas openapi3.Schemas) (string, *openapi3.Operation, error) {
+	d := route.describe()
+
+	op := openapi3.NewOperation()
+	op.Responses = openapi3.NewResponsesWithCapacity(2)
+
+	if d.Request != nil {
+		params, err := parametersFor(d.Request, schemas)
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, param := range params {
+			if param.Value.In == openapi3.ParameterInPath && !strings.Contains(route.Path, "{"+param.Value.Name) {
+				continue
+			}
+
+			op.Parameters = append(op.Parameters, param)
+		}
+	}
+
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(route.Path, -1) {
+		if op.Parameters.GetByInAndName(openapi3.ParameterInPath, match[1]) == nil {
+			op.AddParameter(openapi3.NewPathParameter(match[1]).WithSchema(openapi3.NewStringSchema()))
+		}
+	}
+
+	method := strings.ToUpper(route.Method)
+	var body *openapi3.SchemaRef
+	if d.Request != nil {
+		schema, err := schemaFor(d.Request, schemas)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if schema.Ref != "" || (schema.Value != nil && len(schema.Value.Properties) > 0) {
+			body = schema
+		}
+	}
+
+	if method == "" {
+		method = http.MethodGet
+		if body != nil {
+			method = http.MethodPost
+		}
+	}
+
+	if body != nil && method != http.MethodGet && method != http.MethodHead && method != http.MethodDelete {
+		op.RequestBody = &openapi3.RequestBodyRef{
+			Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(body),
+		}
+	}
+
+	response := openapi3.NewResponse().WithDescription(http.StatusText(http.StatusOK))
+	if d.Response != nil {
+		schema, err := schemaFor(d.Response, schemas)
+		if err != nil {
+			return "", nil, err
+		}
+
+		response = response.WithJSONSchemaRef(schema)
+	}
+	op.AddResponse(http.StatusOK, response)
+
+	if d.Request != nil {
+		schema, err := schemaFor(reflect.TypeFor[extensions.ValidationError](), schemas)
+		if err != nil {
+			return "", nil, err
+		}
+
+		op.AddResponse(http.StatusBadRequest, openapi3.NewResponse().
+			WithDescription(http.StatusText(http.StatusBadRequest)).
+			WithJSONSchemaRef(schema))
+	}
+
+	return method, op, nil
+}
+
+// OpenAPI builds an OpenAPI document (see OPENAPI_VERSION) from the routes registered through the server.
+// Patterns registered directly on the ServeMux passed to NewServer are not documented (see Routes).
+// Schemas are generated from the types of the typed handlers (see Handle) and the ValidationMiddleware bodies,
+// using the `json`, `path`, `query`, `header`, `description` and `example` struct tags.
+// Plain handlers are documented with their path parameters only.
+func (s *Server) OpenAPI(info openapi3.Info) (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: OPENAPI_VERSION,
+		Info:    &info,
+		Paths:   openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: make(openapi3.Schemas),
+		},
+	}
+
+	for _, route := range s.routes {
+		method, op, err := route.operation(doc.Components.Schemas)
+		if err != nil {
+			return nil, err
+		}
+
+		path := strings.ReplaceAll(route.Path, "{$}", "")
+		path = pathParameterPattern.ReplaceAllString(path, "{$1}")
+
+		item := doc.Paths.Value(path)
+		if item == nil {
+			item = &openapi3.PathItem{}
+			doc.Paths.Set(path, item)
+		}
+
+		item.SetOperation(method, op)
+	}
+
+	return doc, nil
+}
+
+// ServeOpenAPI registers `GET /openapi.json` and `GET /openapi.yaml`, serving the document built by OpenAPI.
+// The document is built on the first request, so every route must be registered before the server starts.
+func (s *Server) ServeOpenAPI(info openapi3.Info) {
+	var (
+		once sync.Once
+		doc  *openapi3.T
+		err  error
+	)
+
+	load := func() (*openapi3.T, error) {
+		once.Do(func() {
+			doc, err = s.OpenAPI(info)
+		})
+
+		return doc, err
+	}
+
+	s.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		doc, err := load()
+		if err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+
+		resp, err := doc.MarshalJSON()
+		if err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	})
+
+	s.HandleFunc("GET /openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		doc, err := load()
+		if err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+
+		resp, err := yaml.Marshal(doc)
+		if err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	})
+}
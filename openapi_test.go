@@ -0,0 +1,143 @@
+package mahakam
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/seiortech/mahakam/extensions"
+)
+
+type testSearchRequest struct {
+	Query string `query:"q" description:"Search terms"`
+	Token string `header:"X-Token"`
+}
+
+type testLoginRequest struct {
+	Email string `json:"email" example:"gopher@example.com"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := NewServer("", http.NewServeMux())
+
+	executed := false
+	s.HandleFunc("GET /plain/{name}", func(w http.ResponseWriter, r *http.Request) {
+		executed = true
+	})
+	s.HandleFunc("POST /users/{id}", Handle(testUserHandler))
+	s.HandleFunc("GET /search", Handle(func(ctx context.Context, req testSearchRequest) ([]testUserResponse, error) {
+		return nil, nil
+	}))
+	s.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		executed = true
+	}, extensions.ValidationMiddleware[testLoginRequest])
+
+	doc, err := s.OpenAPI(openapi3.Info{Title: "test", Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("OpenAPI: %v", err)
+	}
+
+	if executed {
+		t.Error("a plain handler was executed while building the document")
+	}
+
+	if doc.OpenAPI != OPENAPI_VERSION {
+		t.Errorf("openapi = %q, want %q", doc.OpenAPI, OPENAPI_VERSION)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("generated document is invalid: %v", err)
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		parameters []string
+		body       []string
+		response   bool
+	}{
+		{http.MethodGet, "/plain/{name}", []string{"path:name"}, nil, false},
+		{http.MethodPost, "/users/{id}", []string{"path:id"}, []string{"name"}, true},
+		{http.MethodGet, "/search", []string{"query:q", "header:X-Token"}, nil, true},
+		{http.MethodPost, "/login", nil, []string{"email"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			item := doc.Paths.Value(tt.path)
+			if item == nil || item.GetOperation(tt.method) == nil {
+				t.Fatalf("operation is missing, paths are %v", doc.Paths.InMatchingOrder())
+			}
+			op := item.GetOperation(tt.method)
+
+			if len(op.Parameters) != len(tt.parameters) {
+				t.Errorf("%d parameters, want %v", len(op.Parameters), tt.parameters)
+			}
+			for i, want := range tt.parameters {
+				if i < len(op.Parameters) && op.Parameters[i].Value.In+":"+op.Parameters[i].Value.Name != want {
+					t.Errorf("parameter %d = %s:%s, want %s", i, op.Parameters[i].Value.In, op.Parameters[i].Value.Name, want)
+				}
+			}
+
+			if tt.body == nil {
+				if op.RequestBody != nil {
+					t.Error("operation has a request body, want none")
+				}
+			} else {
+				if op.RequestBody == nil {
+					t.Fatal("request body is missing")
+				}
+
+				schema := op.RequestBody.Value.Content.Get("application/json").Schema.Value
+				for _, name := range tt.body {
+					if schema.Properties[name] == nil {
+						t.Errorf("request body property %q is missing", name)
+					}
+				}
+
+				if _, ok := schema.Properties["id"]; ok {
+					t.Error("path parameter is part of the request body")
+				}
+			}
+
+			ok := op.Responses.Value("200")
+			if ok == nil {
+				t.Fatal("200 response is missing")
+			}
+
+			if hasSchema := ok.Value.Content.Get("application/json") != nil; hasSchema != tt.response {
+				t.Errorf("200 response has a schema = %v, want %v", hasSchema, tt.response)
+			}
+
+			if hasBadRequest := op.Responses.Value("400") != nil; hasBadRequest != (tt.body != nil || tt.response) {
+				t.Errorf("400 response documented = %v", hasBadRequest)
+			}
+		})
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	s := NewServer("", http.NewServeMux())
+	s.HandleFunc("POST /users/{id}", Handle(testUserHandler))
+	s.ServeOpenAPI(openapi3.Info{Title: "test", Version: "1.0.0"})
+
+	for _, path := range []string{"/openapi.json", "/openapi.yaml"} {
+		w := httptest.NewRecorder()
+		s.dispatch(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", path, w.Code)
+		}
+
+		loaded, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+
+		if loaded.Paths.Value("/users/{id}") == nil {
+			t.Errorf("GET %s is missing /users/{id}", path)
+		}
+	}
+}
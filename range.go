@@ -0,0 +1,63 @@
+package mahakam
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ServeContent replies to the request with the content, supporting RFC 9110 range requests: single ranges,
+// multiple ranges as `multipart/byteranges`, `If-Range`, and the other conditional headers.
+// If the response has no ETag yet, a strong ETag is derived from the size and the modification time of the content,
+// so clients can resume downloads with `If-Range`. Under NET and NETPOLL, *os.File content is sent with sendfile on Linux.
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	if w.Header().Get("ETag") == "" && !modtime.IsZero() {
+		size, err := content.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = content.Seek(0, io.SeekStart)
+		}
+
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", `"`+strconv.FormatInt(modtime.UnixNano(), 36)+"-"+strconv.FormatInt(size, 36)+`"`)
+	}
+
+	http.ServeContent(w, r, name, modtime, content)
+}
+
+// ServeFile replies to the request with the file, with range support (see ServeContent).
+// Directories are not found, as listings are never served.
+func ServeFile(w http.ResponseWriter, r *http.Request, filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	ServeContent(w, r, filepath.Base(filename), info.ModTime(), f)
+}
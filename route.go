@@ -0,0 +1,189 @@
+package mahakam
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// methods is the list of HTTP methods that are probed when checking whether a path is registered for another method.
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// Route describes a pattern registered on the server.
+type Route struct {
+	Method     string   `json:"method"`               // Method of the pattern, empty if the pattern matches every method.
+	Host       string   `json:"host,omitempty"`       // Host of the pattern, empty if the pattern matches every host.
+	Path       string   `json:"path"`                 // Path of the pattern, including wildcards like `{id}`.
+	Pattern    string   `json:"pattern"`              // Pattern is the raw pattern passed to the ServeMux.
+	Middleware []string `json:"middleware,omitempty"` // Middleware lists the names of the global and route middlewares in the order they run.
+
+	handler    http.HandlerFunc
+	middleware []Middleware
+}
+
+// newRoute parses a ServeMux pattern (`[METHOD ][HOST]/[PATH]`) into a Route.
+func newRoute(pattern string, handler http.HandlerFunc, middleware []Middleware) Route {
+	route := Route{
+		Pattern:    pattern,
+		handler:    handler,
+		middleware: middleware,
+	}
+
+	rest := strings.TrimSpace(pattern)
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		route.Method = rest[:i]
+		rest = strings.TrimLeft(rest[i:], " \t")
+	}
+
+	if i := strings.Index(rest, "/"); i > 0 {
+		route.Host = rest[:i]
+		rest = rest[i:]
+	}
+
+	route.Path = rest
+
+	for _, m := range middleware {
+		route.Middleware = append(route.Middleware, funcName(m))
+	}
+
+	return route
+}
+
+// funcName returns a short, human readable name of a function, e.g. `middleware.(*CORS).Middleware`.
+func funcName(f any) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return ""
+	}
+
+	name := strings.TrimSuffix(fn.Name(), "-fm")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return name
+}
+
+// Routes returns every pattern registered through the server, in registration order.
+// Global middlewares bound with Use are listed before the route middlewares.
+// Only the patterns registered with Server.Handle, Server.HandleFunc and the helpers built on them are recorded:
+// the ServeMux passed to NewServer can't be listed, so patterns registered on it directly are missing from Routes,
+// ServeRoutes and OpenAPI.
+func (s *Server) Routes() []Route {
+	routes := make([]Route, 0, len(s.routes))
+	for _, route := range s.routes {
+		middleware := make([]string, 0, len(s.middleware)+len(route.Middleware))
+		for _, m := range s.middleware {
+			middleware = append(middleware, funcName(m))
+		}
+
+		route.Middleware = append(middleware, route.Middleware...)
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// ServeRoutes registers a debug endpoint on the given pattern that serves the registered routes as JSON.
+// Don't expose this endpoint publicly in production, as it leaks the structure of your API.
+func (s *Server) ServeRoutes(pattern string) {
+	s.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		resp, err := json.Marshal(s.Routes())
+		if err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	})
+}
+
+// serveError passes err to the ErrorHandler, or to the default one when the server has none.
+func (s *Server) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	if s.ErrorHandler != nil {
+		s.ErrorHandler(w, r, err)
+		return
+	}
+
+	defaultErrorHandler(w, r, err)
+}
+
+// NotFound sets the handler that is called when no pattern matches the request.
+// The handler runs inside the middleware chain.
+func (s *Server) NotFound(handler http.HandlerFunc) {
+	s.notFound = handler
+}
+
+// MethodNotAllowed sets the handler that is called when the path matches a pattern registered for other methods.
+// The `Allow` header is set before the handler is called. The handler runs inside the middleware chain.
+func (s *Server) MethodNotAllowed(handler http.HandlerFunc) {
+	s.methodNotAllowed = handler
+}
+
+// allowedMethods returns the methods that have a pattern matching the request path.
+func (s *Server) allowedMethods(r *http.Request) []string {
+	allowed := []string{}
+	for _, method := range methods {
+		if method == r.Method {
+			continue
+		}
+
+		clone := r.Clone(r.Context())
+		clone.Method = method
+		if _, pattern := s.mux.Handler(clone); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return allowed
+}
+
+// dispatch is the root handler of the middleware chain. It routes the request through the ServeMux
+// and falls back to the custom NotFound and MethodNotAllowed handlers when they are set.
+// The ErrorHandler is stored in the request context, so typed handlers can report their errors to it.
+func (s *Server) dispatch(w http.ResponseWriter, r *http.Request) {
+	if s.ErrorHandler != nil {
+		r = r.WithContext(context.WithValue(r.Context(), errorHandlerKey, s.ErrorHandler))
+	}
+
+	if s.notFound == nil && s.methodNotAllowed == nil {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+
+	if _, pattern := s.mux.Handler(r); pattern == "" {
+		allowed := s.allowedMethods(r)
+		if len(allowed) > 0 && s.methodNotAllowed != nil {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			s.methodNotAllowed(w, r)
+			return
+		}
+
+		if len(allowed) == 0 && s.notFound != nil {
+			s.notFound(w, r)
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
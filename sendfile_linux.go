@@ -0,0 +1,119 @@
+//go:build linux
+
+package mahakam
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SENDFILE_TIMEOUT is the time sendFile waits for a NETPOLL connection to become writable.
+const SENDFILE_TIMEOUT = time.Minute
+
+// sendFile copies a file to a connection exposing its file descriptor, like NETPOLL connections, with sendfile(2).
+// handled is false when the source or the connection don't support it, so the caller copies the data itself.
+// Standard net.TCPConn connections are not handled here, as the runtime already uses sendfile for them.
+func sendFile(conn net.Conn, src io.Reader) (written int64, handled bool, err error) {
+	fdConn, ok := conn.(interface{ Fd() int })
+	if !ok {
+		return 0, false, nil
+	}
+
+	var (
+		f      *os.File
+		remain int64 = -1
+		lr     *io.LimitedReader
+	)
+
+	switch v := src.(type) {
+	case *os.File:
+		f = v
+	case *io.LimitedReader:
+		if file, ok := v.R.(*os.File); ok {
+			f, remain, lr = file, v.N, v
+		}
+	}
+
+	if f == nil {
+		return 0, false, nil
+	}
+
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	if remain < 0 {
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false, nil
+		}
+
+		remain = info.Size() - offset
+	}
+
+	rawConn, err := f.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	out := fdConn.Fd()
+	handled = true
+
+	controlErr := rawConn.Control(func(in uintptr) {
+		for remain > 0 {
+			n, sendErr := unix.Sendfile(out, int(in), &offset, int(min(remain, 1<<30)))
+			if n > 0 {
+				written += int64(n)
+				remain -= int64(n)
+			}
+
+			switch {
+			case errors.Is(sendErr, unix.EAGAIN):
+				fds := []unix.PollFd{{Fd: int32(out), Events: unix.POLLOUT}}
+				ready, pollErr := unix.Poll(fds, int(SENDFILE_TIMEOUT.Milliseconds()))
+				if pollErr != nil && !errors.Is(pollErr, unix.EINTR) {
+					err = pollErr
+					return
+				}
+
+				if ready == 0 {
+					err = os.ErrDeadlineExceeded
+					return
+				}
+			case errors.Is(sendErr, unix.EINTR):
+			case errors.Is(sendErr, unix.EINVAL), errors.Is(sendErr, unix.ENOSYS):
+				if written == 0 {
+					handled = false
+				} else {
+					err = sendErr
+				}
+				return
+			case sendErr != nil:
+				err = sendErr
+				return
+			case n == 0:
+				return
+			}
+		}
+	})
+
+	if controlErr != nil && err == nil {
+		err = controlErr
+	}
+
+	if _, seekErr := f.Seek(offset, io.SeekStart); seekErr != nil && err == nil {
+		err = seekErr
+	}
+
+	if lr != nil {
+		lr.N -= written
+	}
+
+	return written, handled, err
+}
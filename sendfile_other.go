@@ -0,0 +1,13 @@
+//go:build !linux
+
+package mahakam
+
+import (
+	"io"
+	"net"
+)
+
+// sendFile is only implemented on Linux, other platforms copy the data through the connection.
+func sendFile(conn net.Conn, src io.Reader) (written int64, handled bool, err error) {
+	return 0, false, nil
+}
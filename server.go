@@ -13,14 +13,17 @@ type Middleware = func(http.HandlerFunc) http.HandlerFunc
 
 // Server is a custom HTTP server that uses netpoll for handling connections.
 type Server struct {
-	Address         string
-	mux             *http.ServeMux
-	server          NetworkFramework
-	middleware      []Middleware
-	ErrorHandler    func(http.ResponseWriter, *http.Request, error)
-	TLS             bool
-	certificatePath string
-	keyPath         string
+	Address          string
+	mux              *http.ServeMux
+	server           NetworkFramework
+	middleware       []Middleware
+	routes           []Route
+	notFound         http.HandlerFunc
+	methodNotAllowed http.HandlerFunc
+	ErrorHandler     func(http.ResponseWriter, *http.Request, error)
+	TLS              bool
+	certificatePath  string
+	keyPath          string
 }
 
 // NewServer creates a new Server instance with the specified address and HTTP ServeMux.
@@ -32,26 +35,30 @@ func NewServer(address string, mux *http.ServeMux) *Server {
 		TLS:             false,
 		certificatePath: "",
 		keyPath:         "",
-		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
-			validationErr, ok := err.(extensions.ValidationError)
-			if ok {
-				resp, err := validationErr.JSON()
-				if err != nil {
-					// TODO: edit the message error later to avoid exposing internal errors
-					http.Error(w, fmt.Sprintf("Failed to marshal validation error: %v", err), http.StatusInternalServerError)
-					return
-				}
-
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(validationErr.Code)
-				w.Write(resp)
-				return
-			}
+		ErrorHandler:    defaultErrorHandler,
+	}
+}
+
+// defaultErrorHandler is the ErrorHandler of a new server. It answers validation errors as JSON with their code,
+// and every other error with a 500 status code.
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	validationErr, ok := err.(extensions.ValidationError)
+	if ok {
+		resp, err := validationErr.JSON()
+		if err != nil {
+			// TODO: edit the message error later to avoid exposing internal errors
+			http.Error(w, fmt.Sprintf("Failed to marshal validation error: %v", err), http.StatusInternalServerError)
+			return
+		}
 
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(fmt.Appendf(nil, "%v", err))
-		},
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(validationErr.Code)
+		w.Write(resp)
+		return
 	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(fmt.Appendf(nil, "%v", err))
 }
 
 // ListenAndServe starts the server and listens for incoming connections.
@@ -74,7 +81,7 @@ func (s *Server) ListenAndServe() error {
 	case NETPOLL:
 		s := netpoolFramework{
 			Address:      s.Address,
-			mux:          s.mux,
+			handler:      s.dispatch,
 			middleware:   s.middleware,
 			ErrorHandler: s.ErrorHandler,
 		}
@@ -84,7 +91,7 @@ func (s *Server) ListenAndServe() error {
 		if s.TLS {
 			s := httpFramework{
 				Address:         s.Address,
-				mux:             s.mux,
+				handler:         s.dispatch,
 				middleware:      s.middleware,
 				ErrorHandler:    s.ErrorHandler,
 				certificatePath: s.certificatePath,
@@ -96,7 +103,7 @@ func (s *Server) ListenAndServe() error {
 
 		s := httpFramework{
 			Address:      s.Address,
-			mux:          s.mux,
+			handler:      s.dispatch,
 			middleware:   s.middleware,
 			ErrorHandler: s.ErrorHandler,
 		}
@@ -105,7 +112,7 @@ func (s *Server) ListenAndServe() error {
 	case NET:
 		s := netFramework{
 			Address:      s.Address,
-			mux:          s.mux,
+			handler:      s.dispatch,
 			middleware:   s.middleware,
 			ErrorHandler: s.ErrorHandler,
 		}
@@ -127,28 +134,29 @@ func (s *Server) Use(middleware ...func(http.HandlerFunc) http.HandlerFunc) {
 
 // ServeFiles serves static files from the specified root directory using the given pattern.
 func (s *Server) ServeFiles(pattern string, root http.FileSystem) {
-	if s.mux == nil {
-		s.mux = http.NewServeMux()
-	}
-
-	s.mux.Handle(pattern, http.StripPrefix(pattern, http.FileServer(root)))
+	s.Handle(pattern, http.StripPrefix(pattern, http.FileServer(root)))
 }
 
 // Handle binds a handler to a specific pattern in the server's HTTP ServeMux.
-func (s *Server) Handle(pattern string, handler http.Handler) {
-	if s.mux == nil {
-		s.mux = http.NewServeMux()
-	}
-
-	s.mux.Handle(pattern, handler)
+// The optional middlewares are only applied to this pattern, after the global middlewares.
+func (s *Server) Handle(pattern string, handler http.Handler, middleware ...Middleware) {
+	s.HandleFunc(pattern, handler.ServeHTTP, middleware...)
 }
 
 // HandleFunc binds a handler function to a specific pattern in the server's HTTP ServeMux.
-func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+// The optional middlewares are only applied to this pattern, after the global middlewares.
+// OpenAPI calls the middleware factories again to describe the route, so they must not have side effects.
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc, middleware ...Middleware) {
 	if s.mux == nil {
 		s.mux = http.NewServeMux()
 	}
 
+	s.routes = append(s.routes, newRoute(pattern, handler, middleware))
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
 	s.mux.HandleFunc(pattern, handler)
 }
 
@@ -0,0 +1,213 @@
+package sse
+
+import (
+	"log"
+	"strconv"
+	"sync"
+)
+
+// HubOption contains options for configuring the behavior of a Hub.
+type HubOption struct {
+	// ReplaySize is the number of events kept per channel to replay to clients resuming with `Last-Event-ID`.
+	// Zero disables replay.
+	ReplaySize int
+	// OnError is called when an event cannot be sent to a subscriber. The subscriber is then removed from the channel.
+	OnError func(error)
+}
+
+// DefaultHubOption provides default values for the hub options.
+var DefaultHubOption = HubOption{
+	ReplaySize: 100,
+	OnError: func(err error) {
+		log.Println(err)
+	},
+}
+
+// bufferedEvent is an encoded event kept for replay.
+type bufferedEvent struct {
+	id   string
+	data []byte
+}
+
+// channel holds the subscribers and the replay buffer of a named channel.
+type channel struct {
+	subscribers map[*Stream]bool
+	buffer      []bufferedEvent // buffer is a ring of at most ReplaySize events, start is the oldest one.
+	start       int
+	sequence    uint64
+}
+
+// push adds the event to the replay buffer, dropping the oldest event when it is full.
+func (c *channel) push(event bufferedEvent, size int) {
+	if size <= 0 {
+		return
+	}
+
+	if len(c.buffer) < size {
+		c.buffer = append(c.buffer, event)
+		return
+	}
+
+	c.buffer[c.start] = event
+	c.start = (c.start + 1) % len(c.buffer)
+}
+
+// since returns the buffered events after the id, oldest first. If the id is no longer buffered, every buffered
+// event is returned.
+func (c *channel) since(id string) []bufferedEvent {
+	events := make([]bufferedEvent, 0, len(c.buffer))
+	for i := range c.buffer {
+		events = append(events, c.buffer[(c.start+i)%len(c.buffer)])
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].id == id {
+			return events[i+1:]
+		}
+	}
+
+	return events
+}
+
+// Hub fans events out to the streams subscribed to its named channels.
+type Hub struct {
+	Option   *HubOption
+	channels map[string]*channel
+	Mutex    sync.RWMutex
+}
+
+// NewHub creates a new Hub with the specified options. if option is nil, it uses the default options.
+func NewHub(option *HubOption) *Hub {
+	if option == nil {
+		option = &DefaultHubOption
+	}
+
+	return &Hub{
+		Option:   option,
+		channels: make(map[string]*channel),
+	}
+}
+
+// Subscribe adds the stream to the channel. If the stream was resumed with a `Last-Event-ID`, the buffered events
+// published after it are replayed first. The stream is removed from the channel when it is closed.
+func (h *Hub) Subscribe(name string, s *Stream) error {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	c, ok := h.channels[name]
+	if !ok {
+		c = &channel{subscribers: make(map[*Stream]bool)}
+		h.channels[name] = c
+	}
+
+	if s.LastEventID != "" {
+		for _, event := range c.since(s.LastEventID) {
+			if err := s.write(event.data); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.subscribers[s] = true
+
+	go func() {
+		<-s.Done()
+		h.Unsubscribe(name, s)
+	}()
+
+	return nil
+}
+
+// Unsubscribe removes the stream from the channel. The stream is not closed.
+func (h *Hub) Unsubscribe(name string, s *Stream) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	if c, ok := h.channels[name]; ok {
+		delete(c.subscribers, s)
+	}
+}
+
+// Publish sends the event to every subscriber of the channel and keeps it for replay.
+// If the event has no ID, a sequential ID is assigned. It returns the ID of the event.
+// The subscribers are written to after the hub is unlocked, so a slow stream doesn't block the other channels.
+func (h *Hub) Publish(name string, event Event) (string, error) {
+	h.Mutex.Lock()
+
+	c, ok := h.channels[name]
+	if !ok {
+		c = &channel{subscribers: make(map[*Stream]bool)}
+		h.channels[name] = c
+	}
+
+	c.sequence++
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(c.sequence, 10)
+	}
+
+	data, err := event.encode()
+	if err != nil {
+		h.Mutex.Unlock()
+		return "", err
+	}
+
+	c.push(bufferedEvent{id: event.ID, data: data}, h.Option.ReplaySize)
+
+	subscribers := make([]*Stream, 0, len(c.subscribers))
+	for s := range c.subscribers {
+		subscribers = append(subscribers, s)
+	}
+
+	h.Mutex.Unlock()
+
+	for _, s := range subscribers {
+		if err := s.write(data); err != nil {
+			h.Unsubscribe(name, s)
+
+			if h.Option.OnError != nil {
+				h.Option.OnError(err)
+			}
+		}
+	}
+
+	return event.ID, nil
+}
+
+// Count returns the number of streams subscribed to the channel.
+func (h *Hub) Count(name string) int {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+
+	if c, ok := h.channels[name]; ok {
+		return len(c.subscribers)
+	}
+
+	return 0
+}
+
+// Channels returns the names of the channels of the hub.
+func (h *Hub) Channels() []string {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+
+	names := make([]string, 0, len(h.channels))
+	for name := range h.channels {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Close closes every subscribed stream and removes all channels.
+func (h *Hub) Close() {
+	h.Mutex.Lock()
+	channels := h.channels
+	h.channels = make(map[string]*channel)
+	h.Mutex.Unlock()
+
+	for _, c := range channels {
+		for s := range c.subscribers {
+			s.Close()
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MIME_EVENT_STREAM    = "text/event-stream"
+	HEADER_LAST_EVENT_ID = "Last-Event-ID"
+)
+
+var (
+	ErrorStreamClosed = errors.New("event stream is closed")
+)
+
+// Event is a Server-Sent Event. Data is written as is when it is a string or a byte slice, and encoded as JSON otherwise.
+// Multi-line data is split into several `data:` fields.
+type Event struct {
+	ID    string
+	Event string
+	Data  any
+	Retry time.Duration // Retry asks the client to wait this long before reconnecting. Zero omits the field.
+}
+
+// encode formats the event in the event stream format.
+func (e Event) encode() ([]byte, error) {
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		data = string(b)
+	}
+
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", sanitize(e.ID))
+	}
+
+	if e.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", sanitize(e.Event))
+	}
+
+	if e.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", e.Retry.Milliseconds())
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// sanitize removes the line breaks that would end a field early.
+func sanitize(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// Option contains options for configuring an event stream.
+type Option struct {
+	// Heartbeat is the interval of the comments sent to keep the connection open through proxies. Zero disables heartbeats.
+	Heartbeat time.Duration
+	// Retry is sent to the client when the stream starts, so it knows how long to wait before reconnecting. Zero omits it.
+	Retry time.Duration
+}
+
+// DefaultOption provides default values for the event stream options.
+var DefaultOption = Option{
+	Heartbeat: 15 * time.Second,
+	Retry:     3 * time.Second,
+}
+
+// Stream is an event stream opened with Upgrade. It is safe for concurrent use.
+type Stream struct {
+	// LastEventID is the `Last-Event-ID` header sent by a reconnecting client, used to resume the stream.
+	LastEventID string
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	done        chan struct{}
+	closeOnce   sync.Once
+	mutex       sync.Mutex
+}
+
+// Upgrade starts an event stream on the response with the default options. See UpgradeWithOption.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Stream, error) {
+	return UpgradeWithOption(w, r, nil)
+}
+
+// UpgradeWithOption starts an event stream on the response. if option is nil, it uses the default options.
+// The stream is closed when the client disconnects or a write fails. The handler must not return before the stream
+// is done, see Stream.Wait, and it should close the stream when it stops sending events.
+func UpgradeWithOption(w http.ResponseWriter, r *http.Request, option *Option) (*Stream, error) {
+	if option == nil {
+		option = &DefaultOption
+	}
+
+	w.Header().Set("Content-Type", MIME_EVENT_STREAM)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+
+	s := &Stream{
+		LastEventID: r.Header.Get(HEADER_LAST_EVENT_ID),
+		w:           w,
+		rc:          http.NewResponseController(w),
+		done:        make(chan struct{}),
+	}
+
+	if err := s.rc.Flush(); err != nil {
+		return nil, err
+	}
+
+	if option.Retry > 0 {
+		if err := s.write([]byte("retry: " + strconv.FormatInt(option.Retry.Milliseconds(), 10) + "\n\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	go func() {
+		select {
+		case <-r.Context().Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+
+	if option.Heartbeat > 0 {
+		go s.heartbeat(option.Heartbeat)
+	}
+
+	return s, nil
+}
+
+func (s *Stream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Comment("heartbeat"); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// write sends the encoded data and flushes it. A failed write closes the stream.
+func (s *Stream) write(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+		return ErrorStreamClosed
+	default:
+	}
+
+	_, err := s.w.Write(data)
+	if err == nil {
+		err = s.rc.Flush()
+	}
+
+	if err != nil {
+		s.closeOnce.Do(func() {
+			close(s.done)
+		})
+	}
+
+	return err
+}
+
+// Send sends an event with the name, id and data. Empty names and ids are omitted.
+func (s *Stream) Send(event, id string, data any) error {
+	return s.SendEvent(Event{
+		ID:    id,
+		Event: event,
+		Data:  data,
+	})
+}
+
+// SendEvent sends the event.
+func (s *Stream) SendEvent(e Event) error {
+	data, err := e.encode()
+	if err != nil {
+		return err
+	}
+
+	return s.write(data)
+}
+
+// Retry asks the client to wait d before reconnecting.
+func (s *Stream) Retry(d time.Duration) error {
+	return s.write([]byte("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n"))
+}
+
+// Comment sends a comment, which is ignored by the client.
+func (s *Stream) Comment(text string) error {
+	return s.write([]byte(": " + sanitize(text) + "\n\n"))
+}
+
+// Done returns a channel that is closed when the stream is closed.
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until the stream is closed.
+func (s *Stream) Wait() {
+	<-s.done
+}
+
+// Close closes the stream. Events sent after Close return ErrorStreamClosed.
+func (s *Stream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,248 @@
+package mahakam
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheRule sets the `Cache-Control` header of the static files whose path matches the pattern.
+type CacheRule struct {
+	Pattern *regexp.Regexp
+	Value   string
+}
+
+// StaticOption defines the configuration options for the static file handler.
+type StaticOption struct {
+	// Index is the file served for directories. Directories without it are not found, as listings are never served.
+	Index string
+	// SPAFallback serves the root index for unknown paths without a file extension, so client-side routes load the app.
+	// Unknown paths with an extension, like missing assets, are still not found.
+	SPAFallback bool
+	// Precompressed serves the `.br` or `.gz` sibling of a file, when it exists and the client accepts the encoding.
+	Precompressed bool
+	// CacheControl is checked in order against the file path, the first matching rule sets `Cache-Control`.
+	CacheControl []CacheRule
+}
+
+// DefaultStaticOption provides default values for the static file handler. Files with a hexadecimal content hash
+// in their name, like `app.3f2a9c1b.js` or `app-3f2a9c1b.js`, are cached forever, while HTML files are always revalidated.
+var DefaultStaticOption = StaticOption{
+	Index:         "index.html",
+	SPAFallback:   false,
+	Precompressed: true,
+	CacheControl: []CacheRule{
+		{Pattern: regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[0-9A-Za-z]+$`), Value: "public, max-age=31536000, immutable"},
+		{Pattern: regexp.MustCompile(`\.html?$`), Value: "no-cache"},
+	},
+}
+
+// precompressedEncodings are the encodings of the precompressed siblings, the preferred first.
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{encoding: "br", extension: ".br"},
+	{encoding: "gzip", extension: ".gz"},
+}
+
+// Static serves files from an fs.FS, like an embed.FS or os.DirFS, with strong ETags computed from the file content.
+type Static struct {
+	*StaticOption
+	fsys  fs.FS
+	etags sync.Map // map[string]string, keyed by file name, size and modification time.
+}
+
+// NewStatic creates a new static file handler for the file system. if option is nil, it uses the default options.
+func NewStatic(fsys fs.FS, option *StaticOption) *Static {
+	if option == nil {
+		option = &DefaultStaticOption
+	}
+
+	return &Static{
+		StaticOption: option,
+		fsys:         fsys,
+	}
+}
+
+// ServeStatic serves the files of the file system under the pattern, e.g. `/assets/` or `GET /assets/`.
+// The path of the pattern is stripped before looking up the file. if option is nil, it uses the default options.
+func (s *Server) ServeStatic(pattern string, fsys fs.FS, option *StaticOption) {
+	prefix := pattern
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		prefix = strings.TrimSpace(p)
+	}
+
+	if i := strings.Index(prefix, "/"); i > 0 {
+		prefix = prefix[i:]
+	}
+
+	s.Handle(pattern, http.StripPrefix(strings.TrimSuffix(prefix, "/"), NewStatic(fsys, option)))
+}
+
+func (st *Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := st.resolve(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	st.serveFile(w, r, name)
+}
+
+// resolve returns the name of the file to serve for the request path.
+func (st *Static) resolve(urlPath string) (string, bool) {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	if info, err := fs.Stat(st.fsys, name); err == nil {
+		if !info.IsDir() {
+			return name, true
+		}
+
+		if st.Index != "" {
+			index := path.Join(name, st.Index)
+			if info, err := fs.Stat(st.fsys, index); err == nil && !info.IsDir() {
+				return index, true
+			}
+		}
+
+		return "", false
+	}
+
+	if st.SPAFallback && st.Index != "" && path.Ext(name) == "" {
+		if info, err := fs.Stat(st.fsys, st.Index); err == nil && !info.IsDir() {
+			return st.Index, true
+		}
+	}
+
+	return "", false
+}
+
+// serveFile serves the file, or its precompressed sibling, with http.ServeContent, which handles
+// conditional and range requests.
+func (st *Static) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	served, encoding := name, ""
+	if st.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		for _, candidate := range precompressedEncodings {
+			if !acceptsEncoding(r, candidate.encoding) {
+				continue
+			}
+
+			if info, err := fs.Stat(st.fsys, name+candidate.extension); err == nil && !info.IsDir() {
+				served, encoding = name+candidate.extension, candidate.encoding
+				break
+			}
+		}
+	}
+
+	f, err := st.fsys.Open(served)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		content = bytes.NewReader(b)
+	}
+
+	etag, err := st.etag(served, info, content)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("ETag", etag)
+
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	} else if encoding != "" {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+
+	for _, rule := range st.CacheControl {
+		if rule.Pattern != nil && rule.Pattern.MatchString(name) {
+			header.Set("Cache-Control", rule.Value)
+			break
+		}
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag returns the strong ETag of the file content, computed once per file version.
+func (st *Static) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := name + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + info.ModTime().Format(time.RFC3339Nano)
+	if etag, ok := st.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:18]) + `"`
+	st.etags.Store(key, etag)
+
+	return etag, nil
+}
+
+// acceptsEncoding reports whether the `Accept-Encoding` header of the request allows the encoding.
+// An explicit entry for the encoding wins over the `*` wildcard.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	wildcard := false
+	for _, ae := range parseAccept(strings.Join(r.Header.Values("Accept-Encoding"), ",")) {
+		switch ae.mediaType {
+		case encoding:
+			return ae.q > 0
+		case "*":
+			wildcard = ae.q > 0
+		}
+	}
+
+	return wildcard
+}
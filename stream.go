@@ -0,0 +1,135 @@
+package mahakam
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+)
+
+const (
+	MIME_NDJSON    = "application/x-ndjson"
+	MIME_JSON_SEQ  = "application/json-seq"
+	MIME_CSV       = "text/csv; charset=utf-8"
+	JSON_SEQ_START = 0x1E // JSON_SEQ_START is the record separator that starts every record of a JSON text sequence (RFC 7464).
+)
+
+// Chan returns an iterator over the values received from the channel. The iteration stops when the channel is closed
+// or the context is done, so a stream doesn't wait for a producer after the client disconnected.
+func Chan[T any](ctx context.Context, ch <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item, ok := <-ch:
+				if !ok || !yield(item) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stream writes every item with encode and flushes it to the client, without buffering the whole response.
+// The stream stops when the request context is done or a write fails, which happens when the client disconnects,
+// and the error is returned. The headers are sent before the first item, so errors can't be reported to the client.
+func Stream[T any](w http.ResponseWriter, r *http.Request, contentType string, items iter.Seq[T], encode func(w io.Writer, item T) error) error {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := flushStream(rc); err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	var (
+		buf bytes.Buffer
+		err error
+	)
+
+	for item := range items {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		buf.Reset()
+		if err = encode(&buf, item); err != nil {
+			break
+		}
+
+		if _, err = w.Write(buf.Bytes()); err != nil {
+			break
+		}
+
+		if err = flushStream(rc); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return err
+}
+
+// flushStream flushes the response, ignoring writers that don't support flushing as they write through.
+func flushStream(rc *http.ResponseController) error {
+	if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	return nil
+}
+
+// StreamNDJSON streams the items as newline delimited JSON, one JSON value per line. See Stream.
+func StreamNDJSON[T any](w http.ResponseWriter, r *http.Request, items iter.Seq[T]) error {
+	return Stream(w, r, MIME_NDJSON, items, func(w io.Writer, item T) error {
+		return json.NewEncoder(w).Encode(item)
+	})
+}
+
+// StreamJSONSeq streams the items as a JSON text sequence (RFC 7464), each value is prefixed by the record separator. See Stream.
+func StreamJSONSeq[T any](w http.ResponseWriter, r *http.Request, items iter.Seq[T]) error {
+	return Stream(w, r, MIME_JSON_SEQ, items, func(w io.Writer, item T) error {
+		if _, err := w.Write([]byte{JSON_SEQ_START}); err != nil {
+			return err
+		}
+
+		return json.NewEncoder(w).Encode(item)
+	})
+}
+
+// StreamCSV streams the items as CSV. The header row is written first if it is not empty, then record converts
+// every item into a row. See Stream.
+func StreamCSV[T any](w http.ResponseWriter, r *http.Request, header []string, items iter.Seq[T], record func(item T) []string) error {
+	rows := func(yield func([]string) bool) {
+		if len(header) > 0 && !yield(header) {
+			return
+		}
+
+		for item := range items {
+			if !yield(record(item)) {
+				return
+			}
+		}
+	}
+
+	return Stream(w, r, MIME_CSV, rows, func(w io.Writer, row []string) error {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+
+		cw.Flush()
+		return cw.Error()
+	})
+}
@@ -0,0 +1,116 @@
+package mahakam
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// WarmOption defines the configuration options for Server.Warm.
+type WarmOption struct {
+	// Concurrency is the number of URLs requested at the same time.
+	Concurrency int
+	// Header is added to every warming request, e.g. `Accept-Encoding` to warm the compressed variants.
+	Header http.Header
+}
+
+// DefaultWarmOption provides default values for Server.Warm.
+var DefaultWarmOption = WarmOption{
+	Concurrency: 8,
+}
+
+// Warm requests the URLs with GET through the middleware and routes of the server, so a cache like
+// extensions.CacheMiddleware stores their responses before the server takes traffic. Call it before ListenAndServe,
+// e.g. after a MapCache was restored from its snapshot. It returns the errors of the requests that failed
+// or replied with an error status. if option is nil, it uses the default options.
+func (s *Server) Warm(urls []string, option *WarmOption) error {
+	if option == nil {
+		option = &DefaultWarmOption
+	}
+
+	if s.mux == nil {
+		s.mux = http.NewServeMux()
+	}
+
+	handler := s.dispatch
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		handler = s.middleware[i](handler)
+	}
+
+	jobs := make(chan int)
+	errs := make([]error, len(urls))
+
+	var wg sync.WaitGroup
+	for range max(1, option.Concurrency) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				errs[i] = warm(handler, urls[i], option.Header)
+			}
+		}()
+	}
+
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// warm requests the URL through the handler, discarding the response.
+func warm(handler http.HandlerFunc, url string, header http.Header) (err error) {
+	r, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	for name, values := range header {
+		r.Header[name] = append([]string(nil), values...)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("warming %s: %v", url, recovered)
+		}
+	}()
+
+	w := &warmWriter{header: make(http.Header), status: http.StatusOK}
+	handler(w, r)
+
+	if w.status >= http.StatusBadRequest {
+		return fmt.Errorf("warming %s: status %d", url, w.status)
+	}
+
+	return nil
+}
+
+// warmWriter records the status of a warming request and discards its body.
+type warmWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+}
+
+func (w *warmWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *warmWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+	w.status = code
+}
+
+func (w *warmWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return len(b), nil
+}
@@ -3,8 +3,10 @@ package mahakam
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"time"
 )
 
 // RW is a custom ResponseWriter that implements the http.ResponseWriter interface.
@@ -14,6 +16,8 @@ type RW struct {
 	statusCode int
 	written    bool
 	hijacked   bool
+	head       bool // head is set for HEAD requests, their body is discarded.
+	bodyless   bool // bodyless is set once the headers are written if the response must not have a body.
 	buf        *bufio.ReadWriter
 }
 
@@ -43,6 +47,10 @@ func (w *RW) Write(data []byte) (int, error) {
 		w.WriteHeader(w.statusCode)
 	}
 
+	if w.bodyless {
+		return len(data), nil
+	}
+
 	n, err := w.buf.Write(data)
 	flushErr := w.buf.Flush()
 	if flushErr != nil && err == nil {
@@ -56,6 +64,8 @@ func (w *RW) Header() http.Header {
 	return w.headers
 }
 
+// WriteHeader sends the status line and the headers. As the connection is closed after the response,
+// `Connection: close` is always sent, so clients delimit bodies without `Content-Length` by the end of the connection.
 func (w *RW) WriteHeader(statusCode int) {
 	if w.written {
 		return
@@ -63,16 +73,63 @@ func (w *RW) WriteHeader(statusCode int) {
 
 	w.statusCode = statusCode
 	w.written = true
+	w.bodyless = w.head || (statusCode >= 100 && statusCode < 200) || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified
+
+	if w.headers.Get("Date") == "" {
+		w.headers.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	if statusCode != http.StatusSwitchingProtocols {
+		w.headers.Set("Connection", "close")
+	}
+
+	fmt.Fprintf(w.buf, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	w.headers.Write(w.buf)
+	fmt.Fprintf(w.buf, "\r\n")
+	w.buf.Flush()
+}
+
+// ReadFrom copies the body from src. Files, and files limited by io.LimitedReader as http.ServeContent sends them,
+// are sent with sendfile when the connection supports it, including NETPOLL connections on Linux.
+func (w *RW) ReadFrom(src io.Reader) (int64, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+
+	if !w.written {
+		w.WriteHeader(w.statusCode)
+	}
 
-	fmt.Fprintf(w.conn, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	if w.bodyless {
+		return io.Copy(io.Discard, src)
+	}
+
+	if err := w.buf.Flush(); err != nil {
+		return 0, err
+	}
+
+	if n, handled, err := sendFile(w.conn, src); handled {
+		return n, err
+	}
 
-	for key, values := range w.headers {
-		for _, value := range values {
-			fmt.Fprintf(w.conn, "%s: %s\r\n", key, value)
-		}
+	n, err := w.buf.ReadFrom(src)
+	if flushErr := w.buf.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+
+	return n, err
+}
+
+// Flush sends the headers if they are not written yet, then the buffered data to the connection.
+func (w *RW) Flush() {
+	if w.hijacked {
+		return
+	}
+
+	if !w.written {
+		w.WriteHeader(w.statusCode)
 	}
 
-	fmt.Fprintf(w.conn, "\r\n")
 	w.buf.Flush()
 }
 